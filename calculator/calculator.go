@@ -1,9 +1,6 @@
 package calculator
 
 import (
-	"bytes"
-	"fmt"
-	"strings"
 	"time"
 
 	"github.com/andygrunwald/go-jira"
@@ -11,17 +8,20 @@ import (
 	"github.com/makarski/roadsnap/config"
 )
 
-const (
-	dateFormat = "January 2, 2006"
-)
-
 type Calculator struct {
 	jiraBaseURL string
 	statusNames *config.StatusNames
+	estimator   Estimator
+	calendar    Calendar
 }
 
-func NewCalculator(jiraBaseURL string, statusNames *config.StatusNames) Calculator {
-	return Calculator{jiraBaseURL, statusNames}
+func NewCalculator(jiraBaseURL string, statusNames *config.StatusNames, estimator Estimator, calendar Calendar) Calculator {
+	return Calculator{jiraBaseURL, statusNames, estimator, calendar}
+}
+
+// SetEstimator sets the estimator decided for all the snapshots of a project, see: Estimator.ForSnapshots
+func (c *Calculator) SetEstimator(estimator Estimator) {
+	c.estimator = estimator
 }
 
 func (c *Calculator) GenerateSummary(epics []*cache.EpicLink, project string, date time.Time) Summary {
@@ -35,6 +35,8 @@ func (c *Calculator) GenerateSummary(epics []*cache.EpicLink, project string, da
 		Outstanding:    make([]cache.EpicLink, 0),
 
 		statusConfigs: c.statusNames,
+		estimator:     c.estimator,
+		calendar:      c.calendar,
 	}
 
 	for _, epic := range epics {
@@ -102,6 +104,22 @@ func statusCount(epic cache.EpicLink, statusNames *config.StatusNames) (uint8, u
 	return counters[0].counter, counters[1].counter, counters[2].counter
 }
 
+// weightDone returns the estimate of the done epic issues and of all the epic issues
+func weightDone(epic cache.EpicLink, statusNames *config.StatusNames, estimator Estimator) (float64, float64) {
+	var done, total float64
+
+	for _, issue := range epic.Issues {
+		w := estimator.Weight(issue)
+		total += w
+
+		if isIssueDone(issue, statusNames) {
+			done += w
+		}
+	}
+
+	return done, total
+}
+
 func isIssueDone(issue jira.Issue, statusConfig *config.StatusNames) bool {
 	return sliceContains(statusConfig.Done, issue.Fields.Status.Name)
 }
@@ -135,6 +153,8 @@ type (
 		Outstanding    []cache.EpicLink
 
 		statusConfigs *config.StatusNames
+		estimator     Estimator
+		calendar      Calendar
 	}
 
 	NamedItems struct {
@@ -147,6 +167,84 @@ func (s *Summary) AllCount() int {
 	return len(s.Done) + len(s.Overdue) + len(s.Outstanding) + len(s.Ongoing)
 }
 
+// Weight returns the estimate of all the epic issues, the issue count for the count estimator
+func (s *Summary) Weight(epics []cache.EpicLink) float64 {
+	var total float64
+	for _, epic := range epics {
+		_, w := weightDone(epic, s.statusConfigs, s.estimator)
+		total += w
+	}
+
+	return total
+}
+
+// AllWeight returns the estimate of all the summary issues
+func (s *Summary) AllWeight() float64 {
+	var total float64
+	for _, item := range s.NamedStats() {
+		total += s.Weight(item.Epics)
+	}
+
+	return total
+}
+
+// Estimator returns the estimator the summary is weighted by
+func (s *Summary) Estimator() Estimator {
+	return s.estimator
+}
+
+// SummaryEpic are the story counts and the progress of a summary epic
+type SummaryEpic struct {
+	// Category is the summary group name, ex: "Overdue"
+	Category string
+	Epic     cache.EpicLink
+	Link     string
+	// Alert warns about the epic status out of sync with the planning dates
+	Alert             string
+	Quarter           string
+	StoriesTotal      int
+	StoriesDone       int
+	StoriesInProgress int
+	StoriesToDo       int
+	Estimate          float64
+	EstimateDone      float64
+	Progress          float64
+}
+
+// Epics returns the stats of all the summary epics in the NamedStats order
+func (s *Summary) Epics() []SummaryEpic {
+	epics := make([]SummaryEpic, 0, s.AllCount())
+
+	for _, item := range s.NamedStats() {
+		for _, epic := range item.Epics {
+			doneCnt, inProgrCnt, outstdCnt := statusCount(epic, s.statusConfigs)
+			doneWeight, totalWeight := weightDone(epic, s.statusConfigs, s.estimator)
+
+			progress := 0.0
+			if totalWeight > 0 {
+				progress = doneWeight / totalWeight
+			}
+
+			epics = append(epics, SummaryEpic{
+				Category:          item.Name,
+				Epic:              epic,
+				Link:              s.epicLinkPrefix + "/" + epic.Epic.Key,
+				Alert:             epicStatusNotInSyncMessage(epic, s.statusConfigs),
+				Quarter:           s.calendar.Quarter(epic.DueDate).String() + " " + s.calendar.YearName(s.calendar.Year(epic.DueDate)),
+				StoriesTotal:      len(epic.Issues),
+				StoriesDone:       int(doneCnt),
+				StoriesInProgress: int(inProgrCnt),
+				StoriesToDo:       int(outstdCnt),
+				Estimate:          totalWeight,
+				EstimateDone:      doneWeight,
+				Progress:          progress,
+			})
+		}
+	}
+
+	return epics
+}
+
 func (s *Summary) NamedStats() []NamedItems {
 	return []NamedItems{
 		{
@@ -168,68 +266,6 @@ func (s *Summary) NamedStats() []NamedItems {
 	}
 }
 
-func (s *Summary) String() string {
-	named := s.NamedStats()
-	var buf bytes.Buffer
-
-	fmt.Fprintf(&buf, `
-%s: %s
-======================
-`, s.Project, s.Date.Format(dateFormat))
-
-	for _, item := range named {
-		fmt.Fprintf(&buf, `
-%s (%d/%d)
-----------------------
-`, item.Name, len(item.Epics), s.AllCount())
-
-		for _, epic := range item.Epics {
-			totalIssues := len(epic.Issues)
-			doneCnt, inProgrCnt, outstdCnt := statusCount(epic, s.statusConfigs)
-			completeRatio := float64(doneCnt) / float64(totalIssues)
-
-			labels := ""
-			if len(epic.Epic.Fields.Labels) > 0 {
-				labels = "`" + strings.Join(epic.Epic.Fields.Labels, "`, `") + "`"
-			}
-
-			statusAlert := ""
-			if msg := epicStatusNotInSyncMessage(epic, s.statusConfigs); msg != "" {
-				statusAlert = fmt.Sprintf(`
-> %s
-`, msg)
-			}
-
-			fmt.Fprintf(&buf, `
-#### %s %d [%s](%s/%s): %s
-%s
-%s  
-Status: %s  
-Start: %s  
-Due: %s  
-Total: %d, Done: %d, InProgress: %d, Outstanding: %d  
-Progress: %.2f
-`,
-				quarterByDate(epic.DueDate),
-				epic.DueDate.Year(),
-				epic.Epic.Key,
-				s.epicLinkPrefix,
-				epic.Epic.Key,
-				epic.Epic.Fields.Summary,
-				statusAlert,
-				labels,
-				epic.Epic.Fields.Status.Name,
-				epic.StartDate.Format(dateFormat),
-				epic.DueDate.Format(dateFormat),
-				totalIssues, doneCnt, inProgrCnt, outstdCnt,
-				completeRatio,
-			)
-		}
-	}
-
-	return buf.String()
-}
-
 func epicStatusNotInSyncMessage(epic cache.EpicLink, statusConfig *config.StatusNames) string {
 	if (epic.PastDueDate() || epic.InActivePhase()) && isIssueToDo(epic.Epic, statusConfig) {
 		return "Epic Status Does not correspond Planning Dates"
@@ -262,9 +298,10 @@ func (q Quarter) String() string {
 	return ""
 }
 
-func quarterByDate(date time.Time) Quarter {
+// quarterByDate returns the quarter of the date in a year starting at the given month
+func quarterByDate(date time.Time, yearStart time.Month) Quarter {
 	quarters := []Quarter{Q1, Q2, Q3, Q4}
-	m := int(date.Month())
+	m := (int(date.Month())-int(yearStart)+12)%12 + 1
 
 	for _, q := range quarters {
 		qEnd := int(q * 3)
@@ -0,0 +1,187 @@
+package calculator
+
+import (
+	"fmt"
+	"time"
+)
+
+// Granularity is the length of the report periods
+type Granularity string
+
+const (
+	GranularityWeek     Granularity = "week"
+	GranularityMonth    Granularity = "month"
+	GranularityQuarter  Granularity = "quarter"
+	GranularityHalfYear Granularity = "half-year"
+)
+
+func ParseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case GranularityWeek, GranularityMonth, GranularityQuarter, GranularityHalfYear:
+		return g, nil
+	}
+
+	return "", fmt.Errorf("unsupported granularity: `%s`. expected one of: %s, %s, %s, %s",
+		s, GranularityWeek, GranularityMonth, GranularityQuarter, GranularityHalfYear)
+}
+
+// Label is the report period column name
+func (g Granularity) Label() string {
+	switch g {
+	case GranularityWeek:
+		return "Week"
+	case GranularityQuarter:
+		return "Quarter"
+	case GranularityHalfYear:
+		return "Half-Year"
+	}
+
+	return "Month"
+}
+
+// Calendar splits the time into fiscal years starting at the given month.
+// A fiscal year is named after the calendar year it starts in.
+type Calendar struct {
+	fiscalYearStart time.Month
+}
+
+func NewCalendar(fiscalYearStart int) (Calendar, error) {
+	if fiscalYearStart == 0 {
+		return Calendar{time.January}, nil
+	}
+
+	if fiscalYearStart < 1 || fiscalYearStart > 12 {
+		return Calendar{}, fmt.Errorf("invalid fiscal year start month: %d. expected 1-12", fiscalYearStart)
+	}
+
+	return Calendar{time.Month(fiscalYearStart)}, nil
+}
+
+// Fiscal is false for the calendar year
+func (c Calendar) Fiscal() bool {
+	return c.fiscalYearStart > time.January
+}
+
+// Year returns the fiscal year of the date
+func (c Calendar) Year(date time.Time) int {
+	if date.Month() < c.start() {
+		return date.Year() - 1
+	}
+
+	return date.Year()
+}
+
+// YearStart returns the first day of the fiscal year
+func (c Calendar) YearStart(year int) time.Time {
+	return time.Date(year, c.start(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Quarter returns the fiscal quarter of the date
+func (c Calendar) Quarter(date time.Time) Quarter {
+	return quarterByDate(date, c.start())
+}
+
+// YearName formats the fiscal year, ex: "2026" or "FY2026"
+func (c Calendar) YearName(year int) string {
+	if c.Fiscal() {
+		return fmt.Sprintf("FY%d", year)
+	}
+
+	return fmt.Sprintf("%d", year)
+}
+
+func (c Calendar) start() time.Month {
+	if c.fiscalYearStart == 0 {
+		return time.January
+	}
+
+	return c.fiscalYearStart
+}
+
+// ReportWindow is a single report period, both dates inclusive
+type ReportWindow struct {
+	Title string
+	From  time.Time
+	To    time.Time
+}
+
+// Windows splits the dates into report periods aligned to the calendar.
+// Weeks start on Monday, the first and the last periods are cut to the dates.
+func (c Calendar) Windows(from, to time.Time, granularity Granularity) []ReportWindow {
+	windows := make([]ReportWindow, 0)
+
+	for start := c.periodStart(from, granularity); !start.After(to); {
+		next := c.nextPeriod(start, granularity)
+
+		window := ReportWindow{
+			Title: c.periodTitle(start, granularity),
+			From:  start,
+			To:    next.AddDate(0, 0, -1),
+		}
+
+		if window.From.Before(from) {
+			window.From = from
+		}
+
+		if window.To.After(to) {
+			window.To = to
+		}
+
+		windows = append(windows, window)
+		start = next
+	}
+
+	return windows
+}
+
+func (c Calendar) periodStart(date time.Time, granularity Granularity) time.Time {
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch granularity {
+	case GranularityWeek:
+		return date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+	case GranularityQuarter, GranularityHalfYear:
+		months := 3
+		if granularity == GranularityHalfYear {
+			months = 6
+		}
+
+		yearStart := c.YearStart(c.Year(date))
+		elapsed := (int(date.Month()) - int(yearStart.Month()) + 12) % 12
+
+		return yearStart.AddDate(0, elapsed-elapsed%months, 0)
+	}
+
+	return date.AddDate(0, 0, 1-date.Day())
+}
+
+func (c Calendar) nextPeriod(start time.Time, granularity Granularity) time.Time {
+	switch granularity {
+	case GranularityWeek:
+		return start.AddDate(0, 0, 7)
+	case GranularityQuarter:
+		return start.AddDate(0, 3, 0)
+	case GranularityHalfYear:
+		return start.AddDate(0, 6, 0)
+	}
+
+	return start.AddDate(0, 1, 0)
+}
+
+func (c Calendar) periodTitle(start time.Time, granularity Granularity) string {
+	switch granularity {
+	case GranularityWeek:
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("W%02d, %d", week, year)
+	case GranularityQuarter:
+		return fmt.Sprintf("%s %s", c.Quarter(start), c.YearName(c.Year(start)))
+	case GranularityHalfYear:
+		half := 1
+		if c.Quarter(start) > Q2 {
+			half = 2
+		}
+		return fmt.Sprintf("H%d %s", half, c.YearName(c.Year(start)))
+	}
+
+	return start.Format("Jan, 2006")
+}
@@ -0,0 +1,144 @@
+package calculator
+
+import (
+	"testing"
+	"time"
+)
+
+func mustDate(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func TestQuarterByDate(t *testing.T) {
+	tests := []struct {
+		date      string
+		yearStart time.Month
+		want      Quarter
+	}{
+		{"2026-01-01", time.January, Q1},
+		{"2026-03-31", time.January, Q1},
+		{"2026-04-01", time.January, Q2},
+		{"2026-12-31", time.January, Q4},
+		// fiscal years wrap around the calendar year end
+		{"2026-04-01", time.April, Q1},
+		{"2026-12-31", time.April, Q3},
+		{"2027-01-01", time.April, Q4},
+		{"2027-03-31", time.April, Q4},
+		{"2026-09-30", time.October, Q4},
+		{"2026-10-01", time.October, Q1},
+	}
+
+	for _, tt := range tests {
+		if got := quarterByDate(mustDate(tt.date), tt.yearStart); got != tt.want {
+			t.Errorf("quarterByDate(%s, %s) = %s, want %s", tt.date, tt.yearStart, got, tt.want)
+		}
+	}
+}
+
+func TestCalendarPeriodStart(t *testing.T) {
+	tests := []struct {
+		name        string
+		fiscalStart int
+		date        string
+		granularity Granularity
+		want        string
+	}{
+		{"monday starts its week", 0, "2026-10-12", GranularityWeek, "2026-10-12"},
+		{"sunday belongs to the week before", 0, "2026-10-18", GranularityWeek, "2026-10-12"},
+		{"week across the year end", 0, "2027-01-01", GranularityWeek, "2026-12-28"},
+		{"month", 0, "2026-02-28", GranularityMonth, "2026-02-01"},
+		{"calendar quarter", 0, "2026-08-15", GranularityQuarter, "2026-07-01"},
+		{"fiscal quarter", 4, "2026-08-15", GranularityQuarter, "2026-07-01"},
+		{"fiscal quarter wraps the year end", 4, "2027-02-10", GranularityQuarter, "2027-01-01"},
+		{"fiscal quarter of the year start", 10, "2026-11-30", GranularityQuarter, "2026-10-01"},
+		{"calendar half-year", 0, "2026-06-30", GranularityHalfYear, "2026-01-01"},
+		{"fiscal half-year wraps the year end", 4, "2027-02-10", GranularityHalfYear, "2026-10-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calendar, err := NewCalendar(tt.fiscalStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := calendar.periodStart(mustDate(tt.date), tt.granularity); !got.Equal(mustDate(tt.want)) {
+				t.Errorf("periodStart = %s, want %s", got.Format("2006-01-02"), tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendarWindows(t *testing.T) {
+	tests := []struct {
+		name        string
+		fiscalStart int
+		from, to    string
+		granularity Granularity
+		want        []ReportWindow
+	}{
+		{
+			name: "iso weeks across the year end", from: "2026-12-30", to: "2027-01-06", granularity: GranularityWeek,
+			want: []ReportWindow{
+				{"W53, 2026", mustDate("2026-12-30"), mustDate("2027-01-03")},
+				{"W01, 2027", mustDate("2027-01-04"), mustDate("2027-01-06")},
+			},
+		},
+		{
+			name: "months cut to the dates", from: "2026-01-15", to: "2026-03-10", granularity: GranularityMonth,
+			want: []ReportWindow{
+				{"Jan, 2026", mustDate("2026-01-15"), mustDate("2026-01-31")},
+				{"Feb, 2026", mustDate("2026-02-01"), mustDate("2026-02-28")},
+				{"Mar, 2026", mustDate("2026-03-01"), mustDate("2026-03-10")},
+			},
+		},
+		{
+			name: "fiscal quarters", fiscalStart: 4, from: "2026-01-15", to: "2026-07-10", granularity: GranularityQuarter,
+			want: []ReportWindow{
+				{"Q4 FY2025", mustDate("2026-01-15"), mustDate("2026-03-31")},
+				{"Q1 FY2026", mustDate("2026-04-01"), mustDate("2026-06-30")},
+				{"Q2 FY2026", mustDate("2026-07-01"), mustDate("2026-07-10")},
+			},
+		},
+		{
+			name: "fiscal half-years", fiscalStart: 4, from: "2026-04-01", to: "2027-03-31", granularity: GranularityHalfYear,
+			want: []ReportWindow{
+				{"H1 FY2026", mustDate("2026-04-01"), mustDate("2026-09-30")},
+				{"H2 FY2026", mustDate("2026-10-01"), mustDate("2027-03-31")},
+			},
+		},
+		{
+			name: "single day", from: "2026-10-17", to: "2026-10-17", granularity: GranularityQuarter,
+			want: []ReportWindow{
+				{"Q4 2026", mustDate("2026-10-17"), mustDate("2026-10-17")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calendar, err := NewCalendar(tt.fiscalStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := calendar.Windows(mustDate(tt.from), mustDate(tt.to), tt.granularity)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d windows, want %d: %v", len(got), len(tt.want), got)
+			}
+
+			for i := range got {
+				if got[i].Title != tt.want[i].Title || !got[i].From.Equal(tt.want[i].From) || !got[i].To.Equal(tt.want[i].To) {
+					t.Errorf("window %d = %s %s - %s, want %s %s - %s", i,
+						got[i].Title, got[i].From.Format("2006-01-02"), got[i].To.Format("2006-01-02"),
+						tt.want[i].Title, tt.want[i].From.Format("2006-01-02"), tt.want[i].To.Format("2006-01-02"))
+				}
+			}
+		})
+	}
+}
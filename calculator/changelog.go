@@ -0,0 +1,144 @@
+package calculator
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+)
+
+const (
+	changelogFieldStatus  = "status"
+	changelogFieldDueDate = "duedate"
+)
+
+// Transition is a single field change recorded in the issue changelog
+type Transition struct {
+	At   time.Time
+	From string
+	To   string
+}
+
+// Transitions returns the changes of the issue field ordered by time ASC.
+// The issues cached without changelogs have no transitions.
+func Transitions(issue jira.Issue, field string) ([]Transition, error) {
+	transitions := make([]Transition, 0)
+	if issue.Changelog == nil {
+		return transitions, nil
+	}
+
+	for _, history := range issue.Changelog.Histories {
+		at, err := history.CreatedTime()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse changelog time for issue: %s. %s", issue.Key, err)
+		}
+
+		for _, item := range history.Items {
+			if item.Field != field {
+				continue
+			}
+
+			from, to := item.FromString, item.ToString
+			if field == changelogFieldDueDate {
+				// due date strings are formatted, the raw values are plain dates
+				from, to = changelogValue(item.From), changelogValue(item.To)
+			}
+
+			transitions = append(transitions, Transition{at, from, to})
+		}
+	}
+
+	sort.SliceStable(transitions, func(i, j int) bool { return transitions[i].At.Before(transitions[j].At) })
+
+	return transitions, nil
+}
+
+func changelogValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	return ""
+}
+
+// IssueAt returns the issue as it was at the given time by reverting the status
+// and due date changes recorded after it. The bool is false for the issues cached without changelogs.
+func IssueAt(issue jira.Issue, at time.Time) (jira.Issue, bool, error) {
+	if issue.Changelog == nil || issue.Fields == nil {
+		return issue, false, nil
+	}
+
+	fields := *issue.Fields
+	issue.Fields = &fields
+
+	statuses, err := Transitions(issue, changelogFieldStatus)
+	if err != nil {
+		return issue, false, err
+	}
+
+	// the changelog records the status names only,
+	// the other details of the current status do not apply to the reverted one
+	for i := len(statuses) - 1; i >= 0 && statuses[i].At.After(at); i-- {
+		fields.Status = &jira.Status{Name: statuses[i].From}
+	}
+
+	dueDates, err := Transitions(issue, changelogFieldDueDate)
+	if err != nil {
+		return issue, false, err
+	}
+
+	for i := len(dueDates) - 1; i >= 0 && dueDates[i].At.After(at); i-- {
+		fields.Duedate = jira.Date{}
+
+		if dueDates[i].From == "" {
+			continue
+		}
+
+		dueDate, err := time.Parse(cache.DateFormat, dueDates[i].From)
+		if err != nil {
+			return issue, false, fmt.Errorf("failed to parse changelog due date for issue: %s. %s", issue.Key, err)
+		}
+
+		fields.Duedate = jira.Date(dueDate)
+	}
+
+	return issue, true, nil
+}
+
+// epicsAt returns the snapshot epics as they were at the given time.
+// The bool is false if any epic or issue was cached without a changelog,
+// the epic membership of the issues is not reconstructed.
+func epicsAt(epics []*cache.EpicLink, at time.Time) ([]*cache.EpicLink, bool, error) {
+	rewound := make([]*cache.EpicLink, 0, len(epics))
+
+	for _, epic := range epics {
+		epicIssue, ok, err := IssueAt(epic.Epic, at)
+		if !ok || err != nil {
+			return nil, false, err
+		}
+
+		link, err := cache.NewEpicLink(epicIssue)
+		if err != nil {
+			return nil, false, err
+		}
+
+		link.SnapshotDate = at
+		link.Issues = make([]jira.Issue, 0, len(epic.Issues))
+
+		for _, issue := range epic.Issues {
+			issue, ok, err := IssueAt(issue, at)
+			if !ok || err != nil {
+				return nil, false, err
+			}
+
+			link.Issues = append(link.Issues, issue)
+		}
+
+		rewound = append(rewound, link)
+	}
+
+	return rewound, true, nil
+}
@@ -0,0 +1,200 @@
+package calculator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+)
+
+// change is a changelog item of the test issues, the time is in the "2006-01-02 15:04" format
+type change struct {
+	at, field, from, to string
+}
+
+// testChangelogIssue returns an issue in its cached state with the changes recorded in its changelog
+func testChangelogIssue(key, status, dueDate string, changes ...change) jira.Issue {
+	issue := testIssue(key, status)
+	if dueDate != "" {
+		issue.Fields.Duedate = jira.Date(mustDate(dueDate))
+	}
+
+	issue.Changelog = &jira.Changelog{Histories: make([]jira.ChangelogHistory, 0, len(changes))}
+
+	for _, c := range changes {
+		at, err := time.Parse("2006-01-02 15:04", c.at)
+		if err != nil {
+			panic(err)
+		}
+
+		item := jira.ChangelogItems{Field: c.field, FromString: c.from, ToString: c.to}
+		if c.field == changelogFieldDueDate {
+			// the due date strings are formatted, the raw values are plain dates
+			item = jira.ChangelogItems{Field: c.field, From: c.from, FromString: "formatted", To: c.to, ToString: "formatted"}
+			if c.from == "" {
+				item.From = nil
+			}
+			if c.to == "" {
+				item.To = nil
+			}
+		}
+
+		issue.Changelog.Histories = append(issue.Changelog.Histories, jira.ChangelogHistory{
+			Created: at.Format("2006-01-02T15:04:05.000-0700"),
+			Items:   []jira.ChangelogItems{item},
+		})
+	}
+
+	return issue
+}
+
+func TestIssueAt(t *testing.T) {
+	tests := []struct {
+		name        string
+		issue       jira.Issue
+		at          string
+		wantOk      bool
+		wantStatus  string
+		wantDueDate string
+	}{
+		{
+			name:       "issue without a changelog is not rewound",
+			issue:      testIssue("ST-1", "Done"),
+			at:         "2026-09-01 00:00",
+			wantStatus: "Done",
+		},
+		{
+			name: "status changes after the time are reverted",
+			issue: testChangelogIssue("ST-1", "Done", "",
+				change{"2026-09-01 10:00", changelogFieldStatus, "To Do", "In Progress"},
+				change{"2026-09-10 10:00", changelogFieldStatus, "In Progress", "Done"},
+			),
+			at:         "2026-09-05 00:00",
+			wantOk:     true,
+			wantStatus: "In Progress",
+		},
+		{
+			name: "all the status changes are reverted before the first one",
+			issue: testChangelogIssue("ST-1", "Done", "",
+				change{"2026-09-01 10:00", changelogFieldStatus, "To Do", "In Progress"},
+				change{"2026-09-10 10:00", changelogFieldStatus, "In Progress", "Done"},
+			),
+			at:         "2026-08-31 00:00",
+			wantOk:     true,
+			wantStatus: "To Do",
+		},
+		{
+			name: "changes before the time are kept",
+			issue: testChangelogIssue("ST-1", "Done", "2026-10-01",
+				change{"2026-09-10 10:00", changelogFieldStatus, "In Progress", "Done"},
+				change{"2026-09-11 10:00", changelogFieldDueDate, "2026-09-15", "2026-10-01"},
+			),
+			at:          "2026-09-12 00:00",
+			wantOk:      true,
+			wantStatus:  "Done",
+			wantDueDate: "2026-10-01",
+		},
+		{
+			name: "due date changes after the time are reverted",
+			issue: testChangelogIssue("ST-1", "To Do", "2026-11-01",
+				change{"2026-09-01 10:00", changelogFieldDueDate, "2026-09-15", "2026-10-01"},
+				change{"2026-09-20 10:00", changelogFieldDueDate, "2026-10-01", "2026-11-01"},
+			),
+			at:          "2026-09-10 00:00",
+			wantOk:      true,
+			wantStatus:  "To Do",
+			wantDueDate: "2026-10-01",
+		},
+		{
+			name: "due date set after the time is cleared",
+			issue: testChangelogIssue("ST-1", "To Do", "2026-11-01",
+				change{"2026-09-20 10:00", changelogFieldDueDate, "", "2026-11-01"},
+			),
+			at:         "2026-09-10 00:00",
+			wantOk:     true,
+			wantStatus: "To Do",
+		},
+		{
+			name: "due date cleared after the time is restored",
+			issue: testChangelogIssue("ST-1", "To Do", "",
+				change{"2026-09-20 10:00", changelogFieldDueDate, "2026-10-01", ""},
+			),
+			at:          "2026-09-10 00:00",
+			wantOk:      true,
+			wantStatus:  "To Do",
+			wantDueDate: "2026-10-01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, err := time.Parse("2006-01-02 15:04", tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cachedStatus := tt.issue.Fields.Status.Name
+
+			got, ok, err := IssueAt(tt.issue, at)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if ok != tt.wantOk {
+				t.Errorf("ok = %t, want %t", ok, tt.wantOk)
+			}
+
+			if got.Fields.Status.Name != tt.wantStatus {
+				t.Errorf("status = %s, want %s", got.Fields.Status.Name, tt.wantStatus)
+			}
+
+			var wantDueDate time.Time
+			if tt.wantDueDate != "" {
+				wantDueDate = mustDate(tt.wantDueDate)
+			}
+
+			if dueDate := time.Time(got.Fields.Duedate); !dueDate.Equal(wantDueDate) {
+				t.Errorf("due date = %s, want %s", dueDate.Format("2006-01-02"), tt.wantDueDate)
+			}
+
+			if tt.issue.Fields.Status.Name != cachedStatus {
+				t.Errorf("cached issue status changed to %s", tt.issue.Fields.Status.Name)
+			}
+		})
+	}
+}
+
+func TestEpicsAt(t *testing.T) {
+	epic := testChangelogIssue("EP-1", "Done", "2026-10-01",
+		change{"2026-09-20 10:00", changelogFieldStatus, "In Progress", "Done"},
+		change{"2026-09-20 10:00", changelogFieldDueDate, "2026-09-15", "2026-10-01"},
+	)
+	story := testChangelogIssue("ST-1", "Done", "",
+		change{"2026-09-20 10:00", changelogFieldStatus, "In Progress", "Done"},
+	)
+
+	at := mustDate("2026-09-10")
+
+	rewound, ok, err := epicsAt([]*cache.EpicLink{{Epic: epic, Issues: []jira.Issue{story}}}, at)
+	if err != nil || !ok {
+		t.Fatalf("epicsAt = %t, %v, want the epics rewound", ok, err)
+	}
+
+	got := rewound[0]
+	if got.Epic.Fields.Status.Name != "In Progress" || !got.DueDate.Equal(mustDate("2026-09-15")) || !got.SnapshotDate.Equal(at) {
+		t.Errorf("epic = %s, due %s, snapshot %s, want In Progress, due 2026-09-15, snapshot 2026-09-10",
+			got.Epic.Fields.Status.Name, got.DueDate.Format("2006-01-02"), got.SnapshotDate.Format("2006-01-02"))
+	}
+
+	if got.Issues[0].Fields.Status.Name != "In Progress" {
+		t.Errorf("story status = %s, want In Progress", got.Issues[0].Fields.Status.Name)
+	}
+
+	// a single issue cached without a changelog leaves the epics as cached
+	withoutChangelog := []*cache.EpicLink{{Epic: epic, Issues: []jira.Issue{story, testIssue("ST-2", "Done")}}}
+	if _, ok, err := epicsAt(withoutChangelog, at); ok || err != nil {
+		t.Errorf("epicsAt = %t, %v, want the epics not rewound", ok, err)
+	}
+}
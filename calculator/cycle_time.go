@@ -0,0 +1,256 @@
+package calculator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+)
+
+// flowPercentile is the reported upper percentile of the cycle and lead times
+const flowPercentile = 85
+
+// IssueTimes are the points in time an issue went through its status categories.
+// Zero values are unknown.
+type IssueTimes struct {
+	Key     string
+	Created time.Time
+	// Started is the first move to an in progress status
+	Started time.Time
+	// Done is the last move to a done status, set only for the done issues
+	Done time.Time
+}
+
+// LeadTime is the time from the issue creation to done
+func (it IssueTimes) LeadTime() (time.Duration, bool) {
+	if it.Created.IsZero() || it.Done.IsZero() || it.Done.Before(it.Created) {
+		return 0, false
+	}
+
+	return it.Done.Sub(it.Created), true
+}
+
+// CycleTime is the time from the first in progress status to done
+func (it IssueTimes) CycleTime() (time.Duration, bool) {
+	if it.Started.IsZero() || it.Done.IsZero() || it.Done.Before(it.Started) {
+		return 0, false
+	}
+
+	return it.Done.Sub(it.Started), true
+}
+
+// DurationStats summarizes the durations of the done issues
+type DurationStats struct {
+	Count  int
+	Median time.Duration
+	P85    time.Duration
+}
+
+func newDurationStats(durations []time.Duration) DurationStats {
+	if len(durations) == 0 {
+		return DurationStats{}
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	return DurationStats{
+		Count:  len(durations),
+		Median: percentile(durations, 50),
+		P85:    percentile(durations, flowPercentile),
+	}
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// Days formats the stats in days, ex: "3.5d / 7.0d"
+func (ds DurationStats) Days() string {
+	if ds.Count == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.1fd / %.1fd", ds.Median.Hours()/24, ds.P85.Hours()/24)
+}
+
+// FlowStats are the lead and cycle times of a set of done issues
+type FlowStats struct {
+	LeadTime  DurationStats
+	CycleTime DurationStats
+}
+
+func newFlowStats(times []IssueTimes) FlowStats {
+	lead := make([]time.Duration, 0, len(times))
+	cycle := make([]time.Duration, 0, len(times))
+
+	for _, it := range times {
+		if d, ok := it.LeadTime(); ok {
+			lead = append(lead, d)
+		}
+
+		if d, ok := it.CycleTime(); ok {
+			cycle = append(cycle, d)
+		}
+	}
+
+	return FlowStats{newDurationStats(lead), newDurationStats(cycle)}
+}
+
+// statusObservation is the issue status seen in a snapshot
+type statusObservation struct {
+	Date   time.Time
+	Status Status
+}
+
+// issueTimes returns the status category times of the issue as of the given time.
+// The changelog is used if cached, otherwise the first snapshots where each status appears.
+func (twd *TimeWindowDiffer) issueTimes(project string, issue jira.Issue, asOf time.Time) (IssueTimes, error) {
+	times := IssueTimes{Key: issue.Key}
+	if issue.Fields == nil {
+		return times, nil
+	}
+
+	times.Created = time.Time(issue.Fields.Created)
+	isDone := issue.Fields.Status != nil && twd.statusConverter.Status(issue.Fields.Status.Name).isDone()
+
+	if issue.Changelog != nil {
+		// the issue is done if it was done as of the time, not in its cached state
+		asOfIssue, _, err := IssueAt(issue, asOf)
+		if err != nil {
+			return times, err
+		}
+		isDone = asOfIssue.Fields.Status != nil && twd.statusConverter.Status(asOfIssue.Fields.Status.Name).isDone()
+
+		transitions, err := Transitions(issue, changelogFieldStatus)
+		if err != nil {
+			return times, err
+		}
+
+		for _, t := range transitions {
+			if t.At.After(asOf) {
+				break
+			}
+
+			switch twd.statusConverter.Status(t.To) {
+			case StatusInProgress:
+				if times.Started.IsZero() {
+					times.Started = t.At
+				}
+			case StatusDone:
+				if isDone {
+					times.Done = t.At
+				}
+			}
+		}
+
+		return times, nil
+	}
+
+	history, err := twd.statusHistory(project)
+	if err != nil {
+		return times, err
+	}
+
+	for _, seen := range history[issue.Key] {
+		if seen.Date.After(asOf) {
+			break
+		}
+		twd.snapshotsRead[seen.Date] = true
+
+		switch seen.Status {
+		case StatusInProgress:
+			if times.Started.IsZero() {
+				times.Started = seen.Date
+			}
+			times.Done = time.Time{}
+		case StatusDone:
+			if times.Done.IsZero() && isDone {
+				times.Done = seen.Date
+			}
+		default:
+			times.Done = time.Time{}
+		}
+	}
+
+	return times, nil
+}
+
+// statusHistory returns the issue statuses observed in the project snapshots ordered by date ASC
+func (twd *TimeWindowDiffer) statusHistory(project string) (map[string][]statusObservation, error) {
+	if history, ok := twd.statusHistories[project]; ok {
+		return history, nil
+	}
+
+	entries, err := cache.ListSnapshotDates(twd.store, project)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make(map[string][]statusObservation)
+
+	for _, entry := range entries {
+		dates := append([]string{}, entry.Dates...)
+		sort.Strings(dates)
+
+		for _, date := range dates {
+			t, err := time.Parse(cache.DateFormat, date)
+			if err != nil {
+				return nil, err
+			}
+
+			epics, err := cache.FromCacheOrdered(twd.store, t, project)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, epic := range epics {
+				for _, issue := range epic.Issues {
+					if issue.Fields == nil || issue.Fields.Status == nil {
+						continue
+					}
+
+					status := twd.statusConverter.Status(issue.Fields.Status.Name)
+					history[issue.Key] = append(history[issue.Key], statusObservation{t, status})
+				}
+			}
+		}
+	}
+
+	twd.statusHistories[project] = history
+
+	return history, nil
+}
+
+// flowStats returns the lead and cycle times of the epic issues done as of the epic snapshot
+func (twd *TimeWindowDiffer) flowStats(project string, epic cache.EpicLink, asOf time.Time) ([]IssueTimes, error) {
+	times := make([]IssueTimes, 0, len(epic.Issues))
+
+	for _, issue := range epic.Issues {
+		it, err := twd.issueTimes(project, issue, asOf)
+		if err != nil {
+			return nil, err
+		}
+
+		if !it.Done.IsZero() {
+			times = append(times, it)
+		}
+	}
+
+	return times, nil
+}
+
+// endOfDay returns the last instant of the day
+func endOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+}
@@ -0,0 +1,216 @@
+package calculator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+)
+
+// ChangeKind is the kind of an epic or story change between two snapshots
+type ChangeKind string
+
+const (
+	ChangeAdded      ChangeKind = "added"
+	ChangeRemoved    ChangeKind = "removed"
+	ChangeStatus     ChangeKind = "status"
+	ChangeDueDate    ChangeKind = "due_date"
+	ChangeAssignee   ChangeKind = "assignee"
+	ChangeReparented ChangeKind = "reparented"
+)
+
+// Change is a single epic or story change, the story changes refer to their epic
+type Change struct {
+	Epic      string     `json:"epic"`
+	EpicTitle string     `json:"epic_title"`
+	Key       string     `json:"key"`
+	Title     string     `json:"title"`
+	Link      string     `json:"link"`
+	Kind      ChangeKind `json:"kind"`
+	From      string     `json:"from,omitempty"`
+	To        string     `json:"to,omitempty"`
+	// Days is the due date move in days
+	Days int `json:"days,omitempty"`
+}
+
+// IsEpic is false for the story changes
+func (c Change) IsEpic() bool {
+	return c.Epic == c.Key
+}
+
+// SnapshotDiff lists the changes between two snapshots of a project
+type SnapshotDiff struct {
+	Project string    `json:"project"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Changes []Change  `json:"changes"`
+}
+
+// Diff compares all the epics and stories of two cached snapshots
+func (twd *TimeWindowDiffer) Diff(project string, from, to time.Time) (*SnapshotDiff, error) {
+	dates, err := twd.store.ListDates(project)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, date := range []time.Time{from, to} {
+		if !containsDate(dates, date) {
+			return nil, fmt.Errorf("no snapshot cached for project: %s on %s", project, date.Format(cache.DateFormat))
+		}
+	}
+
+	fromEpics, err := cache.FromCacheOrdered(twd.store, from, project)
+	if err != nil {
+		return nil, err
+	}
+
+	toEpics, err := cache.FromCacheOrdered(twd.store, to, project)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report2{
+		Title:        from.Format(cache.DateFormat) + " - " + to.Format(cache.DateFormat),
+		From:         from,
+		To:           to,
+		SnapshotFrom: from,
+		SnapshotTo:   to,
+		allEpics:     true,
+	}
+
+	report.Estimator = twd.estimator.ForEpics(append(append([]*cache.EpicLink{}, fromEpics...), toEpics...))
+
+	// the lead and cycle times are not compared, only the two snapshots are read
+	twd.writePairs(report, fromEpics, toEpics)
+
+	diff := &SnapshotDiff{Project: project, From: from, To: to, Changes: make([]Change, 0)}
+
+	// the stories are compared across the epics, so that the changes of the moved stories are reported too
+	leftStories := make(map[string]*PlanStory)
+	for _, pair := range report.EpicPairs {
+		for _, story := range pair.Left.PlanStories {
+			leftStories[story.Key] = story
+		}
+	}
+
+	fromParents, toParents := storyParents(fromEpics), storyParents(toEpics)
+
+	for _, pair := range report.EpicPairs {
+		diff.Changes = append(diff.Changes, pairChanges(pair, leftStories, fromParents, toParents)...)
+	}
+
+	return diff, nil
+}
+
+func containsDate(dates []string, date time.Time) bool {
+	for _, d := range dates {
+		if d == date.Format(cache.DateFormat) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pairChanges returns the epic changes followed by its story changes.
+// The story moves are reported once, by the epic the story moved to.
+func pairChanges(pair *Pair, leftStories map[string]*PlanStory, fromParents, toParents map[string]string) []Change {
+	epicChange := func(kind ChangeKind, from, to string) Change {
+		return Change{pair.Key, pair.Title, pair.Key, pair.Title, pair.Link, kind, from, to, 0}
+	}
+
+	storyChange := func(story *PlanStory, kind ChangeKind, from, to string) Change {
+		return Change{pair.Key, pair.Title, story.Key, story.Title, story.Link, kind, from, to, 0}
+	}
+
+	changes := make([]Change, 0)
+
+	switch {
+	case !pair.hasLeft():
+		changes = append(changes, epicChange(ChangeAdded, "", pair.Right.StatusName))
+
+		// the scope changes are recorded for the paired epics only,
+		// the stories of a new epic are either new or moved in
+		for _, story := range pair.Right.PlanStories {
+			if from, ok := fromParents[story.Key]; ok {
+				changes = append(changes, storyChange(story, ChangeReparented, from, pair.Key))
+			} else {
+				changes = append(changes, storyChange(story, ChangeAdded, "", story.StatusName))
+			}
+		}
+	case !pair.hasRight():
+		changes = append(changes, epicChange(ChangeRemoved, pair.Left.StatusName, ""))
+
+		for _, story := range pair.Left.PlanStories {
+			if _, ok := toParents[story.Key]; !ok {
+				changes = append(changes, storyChange(story, ChangeRemoved, story.StatusName, ""))
+			}
+		}
+	default:
+		if pair.Left.StatusName != pair.Right.StatusName {
+			changes = append(changes, epicChange(ChangeStatus, pair.Left.StatusName, pair.Right.StatusName))
+		}
+
+		if change, ok := dueDateChange(pair.Left.DueDate, pair.Right.DueDate); ok {
+			changes = append(changes, epicChange(ChangeDueDate, change.From, change.To))
+			changes[len(changes)-1].Days = change.Days
+		}
+	}
+
+	for _, story := range pair.Added {
+		changes = append(changes, storyChange(story, ChangeAdded, "", story.StatusName))
+	}
+
+	for _, story := range pair.Removed {
+		changes = append(changes, storyChange(story, ChangeRemoved, story.StatusName, ""))
+	}
+
+	for _, moved := range pair.Reparented {
+		if moved.To == pair.Key {
+			changes = append(changes, storyChange(moved.Story, ChangeReparented, moved.From, moved.To))
+		}
+	}
+
+	for _, right := range pair.Right.PlanStories {
+		left, ok := leftStories[right.Key]
+		if !ok {
+			continue
+		}
+
+		if left.StatusName != right.StatusName {
+			changes = append(changes, storyChange(right, ChangeStatus, left.StatusName, right.StatusName))
+		}
+
+		if change, ok := dueDateChange(left.DueDate, right.DueDate); ok {
+			changes = append(changes, storyChange(right, ChangeDueDate, change.From, change.To))
+			changes[len(changes)-1].Days = change.Days
+		}
+
+		if left.Assignee != right.Assignee {
+			changes = append(changes, storyChange(right, ChangeAssignee, left.Assignee, right.Assignee))
+		}
+	}
+
+	return changes
+}
+
+func dueDateChange(from, to time.Time) (Change, bool) {
+	if from.Equal(to) {
+		return Change{}, false
+	}
+
+	change := Change{Kind: ChangeDueDate}
+	if !from.IsZero() {
+		change.From = from.Format(cache.DateFormat)
+	}
+
+	if !to.IsZero() {
+		change.To = to.Format(cache.DateFormat)
+	}
+
+	if !from.IsZero() && !to.IsZero() {
+		change.Days = int(to.Sub(from).Hours() / 24)
+	}
+
+	return change, true
+}
@@ -0,0 +1,145 @@
+package calculator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/config"
+)
+
+// EstimateField is the issue field progress is weighted by
+type EstimateField string
+
+const (
+	EstimateCount             EstimateField = "count"
+	EstimateStoryPoints       EstimateField = "story_points"
+	EstimateOriginalEstimate  EstimateField = "original_estimate"
+	EstimateRemainingEstimate EstimateField = "remaining_estimate"
+)
+
+// Estimator weights the issues by their estimate.
+// The count estimator weights every issue as 1.
+type Estimator struct {
+	field            EstimateField
+	storyPointsField string
+}
+
+func NewEstimator(cfg *config.Estimate) (Estimator, error) {
+	if cfg == nil {
+		return Estimator{field: EstimateCount}, nil
+	}
+
+	switch EstimateField(cfg.Field) {
+	case "", EstimateCount:
+		return Estimator{field: EstimateCount}, nil
+	case EstimateStoryPoints:
+		if cfg.StoryPointsField == "" {
+			return Estimator{}, fmt.Errorf("estimate.story_points_field is required for the `%s` estimate", EstimateStoryPoints)
+		}
+		return Estimator{EstimateStoryPoints, cfg.StoryPointsField}, nil
+	case EstimateOriginalEstimate, EstimateRemainingEstimate:
+		return Estimator{field: EstimateField(cfg.Field)}, nil
+	}
+
+	return Estimator{}, fmt.Errorf("unsupported estimate field: `%s`. expected one of: %s, %s, %s, %s",
+		cfg.Field, EstimateCount, EstimateStoryPoints, EstimateOriginalEstimate, EstimateRemainingEstimate)
+}
+
+// Weighted is false for the count estimator
+func (e Estimator) Weighted() bool {
+	return e.field != "" && e.field != EstimateCount
+}
+
+// Unit is the estimate unit shown in the reports, empty for the count estimator
+func (e Estimator) Unit() string {
+	switch e.field {
+	case EstimateStoryPoints:
+		return "pts"
+	case EstimateOriginalEstimate, EstimateRemainingEstimate:
+		return "h"
+	}
+
+	return ""
+}
+
+// Weight returns the issue estimate, unestimated issues weigh 0
+func (e Estimator) Weight(issue jira.Issue) float64 {
+	w, _ := e.estimate(issue)
+	return w
+}
+
+func (e Estimator) estimate(issue jira.Issue) (float64, bool) {
+	if !e.Weighted() {
+		return 1, true
+	}
+
+	if issue.Fields == nil {
+		return 0, false
+	}
+
+	switch e.field {
+	case EstimateStoryPoints:
+		points, ok := issue.Fields.Unknowns[e.storyPointsField].(float64)
+		return points, ok
+	case EstimateOriginalEstimate:
+		return float64(issue.Fields.TimeOriginalEstimate) / 3600, issue.Fields.TimeOriginalEstimate > 0
+	case EstimateRemainingEstimate:
+		return float64(issue.Fields.TimeEstimate) / 3600, issue.Fields.TimeEstimate > 0
+	}
+
+	return 0, false
+}
+
+// ForEpics falls back to the count estimator if none of the epic issues is estimated,
+// ex: snapshots cached before the estimate field was filled in
+func (e Estimator) ForEpics(epics []*cache.EpicLink) Estimator {
+	if !e.Weighted() {
+		return e
+	}
+
+	for _, epic := range epics {
+		for _, issue := range epic.Issues {
+			if _, ok := e.estimate(issue); ok {
+				return e
+			}
+		}
+	}
+
+	return Estimator{field: EstimateCount}
+}
+
+// ForSnapshots falls back to the count estimator if any of the project snapshots has no estimated issue,
+// so that the progress of all the snapshots is compared in the same unit
+func (e Estimator) ForSnapshots(store cache.Store, project string, dates []time.Time) (Estimator, error) {
+	if !e.Weighted() {
+		return e, nil
+	}
+
+	for _, date := range dates {
+		epics, err := cache.FromCacheOrdered(store, date, project)
+		if err != nil {
+			return e, err
+		}
+
+		if !e.ForEpics(epics).Weighted() {
+			return Estimator{field: EstimateCount}, nil
+		}
+	}
+
+	return e, nil
+}
+
+// FormatWeight formats the weight with its unit, ex: "13 pts"
+func (e Estimator) FormatWeight(w float64) string {
+	s := strconv.FormatFloat(math.Round(w*10)/10, 'f', -1, 64)
+	if !e.Weighted() {
+		return s
+	}
+
+	return s + " " + e.Unit()
+}
@@ -0,0 +1,266 @@
+package calculator
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+
+	// maxForecastWeeks caps a simulation run for a near zero throughput
+	maxForecastWeeks = 520
+)
+
+// ForecastRisk flags the epics which are likely to miss their due date
+type ForecastRisk string
+
+const (
+	ForecastOnTrack    ForecastRisk = "On track"
+	ForecastAtRisk     ForecastRisk = "At risk"
+	ForecastLikelyLate ForecastRisk = "Likely late"
+	ForecastNoDueDate  ForecastRisk = "No due date"
+)
+
+// WeeklyThroughput returns the number of stories done per week over the given number of weeks until the date.
+// The stories done between two consecutive snapshots are spread evenly over the days in between,
+// only the weeks fully covered by the snapshots are returned.
+func WeeklyThroughput(store cache.Store, sc StatusConverter, project string, weeks int, until time.Time) ([]float64, error) {
+	entries, err := cache.ListSnapshotDates(store, project)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	dates := append([]string{}, entries[0].Dates...)
+	sort.Strings(dates)
+
+	windowStart := until.AddDate(0, 0, -7*weeks)
+
+	// the last snapshot before the window is the base of the first interval
+	first := 0
+	for i, date := range dates {
+		if date <= windowStart.Format(cache.DateFormat) {
+			first = i
+		}
+	}
+
+	perDay := make(map[string]float64)
+	var prevDate time.Time
+	var prevDone map[string]bool
+
+	for _, date := range dates[first:] {
+		t, err := time.Parse(cache.DateFormat, date)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.After(until) {
+			break
+		}
+
+		epics, err := cache.FromCacheOrdered(store, t, project)
+		if err != nil {
+			return nil, err
+		}
+
+		done := doneStories(sc, epics)
+
+		if prevDone != nil {
+			completed := 0
+			for key := range done {
+				if !prevDone[key] {
+					completed++
+				}
+			}
+
+			days := int(t.Sub(prevDate) / day)
+			for d := 1; d <= days; d++ {
+				perDay[prevDate.AddDate(0, 0, d).Format(cache.DateFormat)] = float64(completed) / float64(days)
+			}
+		}
+
+		prevDate, prevDone = t, done
+	}
+
+	throughput := make([]float64, 0, weeks)
+
+	for w := 0; w < weeks; w++ {
+		weekEnd := until.AddDate(0, 0, -7*w)
+		total, covered := 0.0, true
+
+		for d := 0; d < 7; d++ {
+			rate, ok := perDay[weekEnd.AddDate(0, 0, -d).Format(cache.DateFormat)]
+			covered = covered && ok
+			total += rate
+		}
+
+		if !covered {
+			break
+		}
+
+		throughput = append(throughput, total)
+	}
+
+	return throughput, nil
+}
+
+func doneStories(sc StatusConverter, epics []*cache.EpicLink) map[string]bool {
+	done := make(map[string]bool)
+
+	for _, epic := range epics {
+		for _, issue := range epic.Issues {
+			if issue.Fields != nil && issue.Fields.Status != nil && sc.Status(issue.Fields.Status.Name).isDone() {
+				done[issue.Key] = true
+			}
+		}
+	}
+
+	return done
+}
+
+// EpicForecast is the simulated completion of an open epic
+type EpicForecast struct {
+	Epic      cache.EpicLink
+	Remaining int
+	P50       time.Time
+	P85       time.Time
+	P95       time.Time
+	// OnTime is the share of the simulation runs completed by the due date
+	OnTime float64
+}
+
+// Risk compares the completion percentiles with the epic due date
+func (ef EpicForecast) Risk() ForecastRisk {
+	if ef.Epic.DueDate.IsZero() {
+		return ForecastNoDueDate
+	}
+
+	dueDate := endOfDay(ef.Epic.DueDate)
+
+	if ef.P50.After(dueDate) {
+		return ForecastLikelyLate
+	}
+
+	if ef.P85.After(dueDate) {
+		return ForecastAtRisk
+	}
+
+	return ForecastOnTrack
+}
+
+// Forecaster runs Monte Carlo simulations of the epic completion
+// by sampling the historical weekly throughput
+type Forecaster struct {
+	sc   StatusConverter
+	runs int
+	rnd  *rand.Rand
+}
+
+func NewForecaster(sc StatusConverter, runs int, seed int64) Forecaster {
+	return Forecaster{sc, runs, rand.New(rand.NewSource(seed))}
+}
+
+// Forecast returns the completion forecasts of the open epics with remaining stories.
+// The epics share the project throughput and are worked in the order of their due dates,
+// the epics with no due date last. Each run simulates all the epics at once.
+func (f Forecaster) Forecast(epics []*cache.EpicLink, throughput []float64, from time.Time) []EpicForecast {
+	open := make([]*cache.EpicLink, 0, len(epics))
+	remaining := make(map[string]int, len(epics))
+
+	for _, epic := range epics {
+		if epic.Epic.Fields == nil || epic.Epic.Fields.Status != nil && f.sc.Status(epic.Epic.Fields.Status.Name).isDone() {
+			continue
+		}
+
+		count := 0
+		for _, issue := range epic.Issues {
+			if issue.Fields == nil || issue.Fields.Status == nil || !f.sc.Status(issue.Fields.Status.Name).isDone() {
+				count++
+			}
+		}
+
+		if count == 0 {
+			continue
+		}
+
+		open = append(open, epic)
+		remaining[epic.Epic.Key] = count
+	}
+
+	sort.SliceStable(open, func(i, j int) bool {
+		if open[i].DueDate.IsZero() || open[j].DueDate.IsZero() {
+			return !open[i].DueDate.IsZero() && open[j].DueDate.IsZero()
+		}
+
+		return open[i].DueDate.Before(open[j].DueDate)
+	})
+
+	work := make([]float64, 0, len(open))
+	for _, epic := range open {
+		work = append(work, float64(remaining[epic.Epic.Key]))
+	}
+
+	durations := make([][]time.Duration, len(open))
+	onTime := make([]int, len(open))
+
+	for run := 0; run < f.runs; run++ {
+		for i, d := range f.simulate(work, throughput) {
+			durations[i] = append(durations[i], d)
+
+			if !open[i].DueDate.IsZero() && !from.Add(d).After(endOfDay(open[i].DueDate)) {
+				onTime[i]++
+			}
+		}
+	}
+
+	forecasts := make([]EpicForecast, 0, len(open))
+
+	for i, epic := range open {
+		sort.Slice(durations[i], func(a, b int) bool { return durations[i][a] < durations[i][b] })
+
+		forecasts = append(forecasts, EpicForecast{
+			Epic:      *epic,
+			Remaining: remaining[epic.Epic.Key],
+			P50:       from.Add(percentile(durations[i], 50)),
+			P85:       from.Add(percentile(durations[i], 85)),
+			P95:       from.Add(percentile(durations[i], 95)),
+			OnTime:    float64(onTime[i]) / float64(f.runs),
+		})
+	}
+
+	return forecasts
+}
+
+// simulate returns the completion times of the remaining stories of the epics worked one after another.
+// The week an epic is completed in is prorated by the remaining share of its throughput.
+func (f Forecaster) simulate(remaining []float64, throughput []float64) []time.Duration {
+	durations := make([]time.Duration, 0, len(remaining))
+	done, target := 0.0, 0.0
+
+	for weeks := 0; weeks < maxForecastWeeks && len(durations) < len(remaining); weeks++ {
+		sample := throughput[f.rnd.Intn(len(throughput))]
+
+		for len(durations) < len(remaining) {
+			next := target + remaining[len(durations)]
+			if done+sample < next {
+				break
+			}
+
+			share := (next - done) / sample
+			durations = append(durations, time.Duration(weeks)*week+time.Duration(share*float64(week)).Round(day))
+			target = next
+		}
+
+		done += sample
+	}
+
+	for len(durations) < len(remaining) {
+		durations = append(durations, maxForecastWeeks*week)
+	}
+
+	return durations
+}
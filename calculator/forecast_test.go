@@ -0,0 +1,246 @@
+package calculator
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/config"
+)
+
+var testStatusConverter = NewStatusConverter(&config.StatusNames{
+	Done:       []string{"Done"},
+	InProgress: []string{"In Progress"},
+	ToDo:       []string{"To Do"},
+})
+
+func testIssue(key, status string) jira.Issue {
+	return jira.Issue{Key: key, Fields: &jira.IssueFields{Status: &jira.Status{Name: status}}}
+}
+
+func testEpic(key, status, dueDate string, statuses ...string) *cache.EpicLink {
+	epic := &cache.EpicLink{Epic: testIssue(key, status)}
+	if dueDate != "" {
+		epic.DueDate = mustDate(dueDate)
+	}
+
+	for i, s := range statuses {
+		epic.Issues = append(epic.Issues, testIssue(key+"-"+string(rune('A'+i)), s))
+	}
+
+	return epic
+}
+
+// putDoneSnapshots stores a single epic snapshot per date with the given number of done stories
+func putDoneSnapshots(t *testing.T, store cache.Store, done map[string]int) {
+	for date, count := range done {
+		issues := make([]jira.Issue, 0, count)
+		for i := 0; i < count; i++ {
+			issues = append(issues, testIssue("ST-"+string(rune('A'+i)), "Done"))
+		}
+
+		err := store.Put(&cache.Snapshot{
+			Project: "Project",
+			Date:    mustDate(date),
+			Epics:   []jira.Issue{testIssue("EP-1", "In Progress")},
+			Issues:  map[string][]jira.Issue{"EP-1": issues},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWeeklyThroughput(t *testing.T) {
+	tests := []struct {
+		name  string
+		done  map[string]int
+		weeks int
+		want  []float64
+	}{
+		{
+			name:  "weekly snapshots",
+			done:  map[string]int{"2026-10-03": 1, "2026-10-10": 3, "2026-10-17": 4},
+			weeks: 2,
+			want:  []float64{1, 2},
+		},
+		{
+			name:  "stories are prorated over the days between the snapshots",
+			done:  map[string]int{"2026-10-03": 0, "2026-10-13": 5, "2026-10-17": 7},
+			weeks: 2,
+			want:  []float64{3.5, 3.5},
+		},
+		{
+			name:  "weeks not covered by the snapshots are dropped",
+			done:  map[string]int{"2026-10-03": 0, "2026-10-13": 5, "2026-10-17": 7},
+			weeks: 3,
+			want:  []float64{3.5, 3.5},
+		},
+		{
+			name:  "snapshots after the date are ignored",
+			done:  map[string]int{"2026-10-10": 0, "2026-10-17": 7, "2026-10-24": 14},
+			weeks: 1,
+			want:  []float64{7},
+		},
+		{
+			name:  "single snapshot has no throughput",
+			done:  map[string]int{"2026-10-17": 3},
+			weeks: 1,
+			want:  []float64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := cache.NewFSStore(t.TempDir())
+			putDoneSnapshots(t, store, tt.done)
+
+			got, err := WeeklyThroughput(store, testStatusConverter, "Project", tt.weeks, mustDate("2026-10-17"))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("throughput = %v, want %v", got, tt.want)
+			}
+
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Errorf("throughput = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestWeeklyThroughputNoSnapshots(t *testing.T) {
+	got, err := WeeklyThroughput(cache.NewFSStore(t.TempDir()), testStatusConverter, "Project", 4, mustDate("2026-10-17"))
+	if err != nil || got != nil {
+		t.Errorf("WeeklyThroughput = %v, %v, want no throughput", got, err)
+	}
+}
+
+func TestForecasterSimulate(t *testing.T) {
+	tests := []struct {
+		name       string
+		remaining  []float64
+		throughput []float64
+		want       []time.Duration
+	}{
+		{
+			name:       "completed at the week end",
+			remaining:  []float64{2},
+			throughput: []float64{2},
+			want:       []time.Duration{week},
+		},
+		{
+			name:       "last week is prorated to days",
+			remaining:  []float64{3},
+			throughput: []float64{2},
+			want:       []time.Duration{week + 4*day},
+		},
+		{
+			name:       "epics are worked one after another",
+			remaining:  []float64{1, 4},
+			throughput: []float64{2},
+			want:       []time.Duration{4 * day, 2*week + 4*day},
+		},
+		{
+			name:       "several epics completed within a week",
+			remaining:  []float64{1, 1, 2},
+			throughput: []float64{4},
+			want:       []time.Duration{2 * day, 4 * day, week},
+		},
+		{
+			name:       "zero throughput is capped",
+			remaining:  []float64{1, 2},
+			throughput: []float64{0},
+			want:       []time.Duration{maxForecastWeeks * week, maxForecastWeeks * week},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewForecaster(testStatusConverter, 1, 1)
+
+			got := f.simulate(tt.remaining, tt.throughput)
+			if len(got) != len(tt.want) {
+				t.Fatalf("simulate = %v, want %v", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("simulate = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestForecast(t *testing.T) {
+	epics := []*cache.EpicLink{
+		testEpic("EP-1", "In Progress", "", "To Do"),
+		testEpic("EP-2", "In Progress", "2026-12-01", "Done", "To Do", "In Progress"),
+		testEpic("EP-3", "Done", "2026-10-01", "To Do"),
+		testEpic("EP-4", "To Do", "2026-11-01", "To Do"),
+		testEpic("EP-5", "In Progress", "2026-11-15", "Done"),
+	}
+
+	from := mustDate("2026-10-17")
+	forecasts := NewForecaster(testStatusConverter, 10, 1).Forecast(epics, []float64{1}, from)
+
+	want := []struct {
+		key       string
+		remaining int
+		p50       time.Time
+		risk      ForecastRisk
+	}{
+		{"EP-4", 1, from.Add(week), ForecastOnTrack},
+		{"EP-2", 2, from.Add(3 * week), ForecastOnTrack},
+		{"EP-1", 1, from.Add(4 * week), ForecastNoDueDate},
+	}
+
+	if len(forecasts) != len(want) {
+		t.Fatalf("got %d forecasts, want %d", len(forecasts), len(want))
+	}
+
+	for i, w := range want {
+		fc := forecasts[i]
+		if fc.Epic.Epic.Key != w.key || fc.Remaining != w.remaining || !fc.P50.Equal(w.p50) || fc.Risk() != w.risk {
+			t.Errorf("forecast %d = %s, %d remaining, P50 %s, %s, want %s, %d remaining, P50 %s, %s", i,
+				fc.Epic.Epic.Key, fc.Remaining, fc.P50.Format(cache.DateFormat), fc.Risk(),
+				w.key, w.remaining, w.p50.Format(cache.DateFormat), w.risk)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 0, 10)
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i)*day)
+	}
+
+	tests := []struct {
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{sorted, 0, day},
+		{sorted, 50, 5 * day},
+		{sorted, 85, 9 * day},
+		{sorted, 95, 10 * day},
+		{sorted, 100, 10 * day},
+		{sorted[:1], 85, day},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%d values, %.0f) = %s, want %s", len(tt.sorted), tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package calculator
+
+import (
+	"github.com/makarski/roadsnap/cmd/cache"
+)
+
+// writeScopeChanges compares the stories of the paired epics.
+// The story epics are looked up in the whole snapshots, so that a story moved
+// to an epic due outside of the period is reported as re-parented rather than removed.
+func writeScopeChanges(report *Report2, fromState, toState []*cache.EpicLink) {
+	fromParents := storyParents(fromState)
+	toParents := storyParents(toState)
+
+	for _, pair := range report.EpicPairs {
+		if !pair.hasLeft() || !pair.hasRight() {
+			continue
+		}
+
+		leftKeys := make(map[string]bool, len(pair.Left.PlanStories))
+		for _, story := range pair.Left.PlanStories {
+			leftKeys[story.Key] = true
+		}
+
+		rightKeys := make(map[string]bool, len(pair.Right.PlanStories))
+		for _, story := range pair.Right.PlanStories {
+			rightKeys[story.Key] = true
+
+			if leftKeys[story.Key] {
+				continue
+			}
+
+			if from, ok := fromParents[story.Key]; ok {
+				pair.Reparented = append(pair.Reparented, &ReparentedStory{story, from, pair.Key})
+			} else {
+				pair.Added = append(pair.Added, story)
+			}
+		}
+
+		for _, story := range pair.Left.PlanStories {
+			if rightKeys[story.Key] {
+				continue
+			}
+
+			if to, ok := toParents[story.Key]; ok {
+				pair.Reparented = append(pair.Reparented, &ReparentedStory{story, pair.Key, to})
+			} else {
+				pair.Removed = append(pair.Removed, story)
+			}
+		}
+	}
+}
+
+// storyParents returns the epic keys by story key
+func storyParents(epics []*cache.EpicLink) map[string]string {
+	parents := make(map[string]string)
+
+	for _, epic := range epics {
+		for _, issue := range epic.Issues {
+			parents[issue.Key] = epic.Epic.Key
+		}
+	}
+
+	return parents
+}
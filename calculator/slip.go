@@ -0,0 +1,154 @@
+package calculator
+
+import (
+	"sort"
+	"time"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+)
+
+const (
+	// an epic is chronically slipping if rescheduled at least chronicReschedules times
+	// or if its due date moved by at least chronicSlipDays in total
+	chronicReschedules = 3
+	chronicSlipDays    = 60
+)
+
+// DueDateChange is a due date change observed between two consecutive snapshots of an epic.
+// A zero From or To is a due date which was set or cleared.
+type DueDateChange struct {
+	ObservedAt time.Time
+	From       time.Time
+	To         time.Time
+}
+
+// Days is the number of days the due date moved by, positive if postponed
+func (c DueDateChange) Days() int {
+	if c.From.IsZero() || c.To.IsZero() {
+		return 0
+	}
+
+	return int(c.To.Sub(c.From) / day)
+}
+
+// SlipHistory is the due date timeline of an epic across all the snapshots
+type SlipHistory struct {
+	Key       string
+	Title     string
+	FirstSeen time.Time
+	// Initial is the due date in the first snapshot of the epic
+	Initial time.Time
+	// Current is the due date in the latest snapshot of the epic
+	Current time.Time
+	Changes []DueDateChange
+}
+
+// Reschedules is the number of times a set due date was moved
+func (h SlipHistory) Reschedules() int {
+	n := 0
+	for _, c := range h.Changes {
+		if !c.From.IsZero() && !c.To.IsZero() {
+			n++
+		}
+	}
+
+	return n
+}
+
+// CumulativeSlip is the sum of the due date moves in days
+func (h SlipHistory) CumulativeSlip() int {
+	days := 0
+	for _, c := range h.Changes {
+		days += c.Days()
+	}
+
+	return days
+}
+
+// Chronic is true for the epics rescheduled repeatedly or slipped by a long period
+func (h SlipHistory) Chronic() bool {
+	return h.Reschedules() >= chronicReschedules || h.CumulativeSlip() >= chronicSlipDays
+}
+
+// SlipHistory returns the due date timelines of all the project epics ever cached, ordered by the epic key
+func (twd *TimeWindowDiffer) SlipHistory(project string) ([]SlipHistory, error) {
+	entries, err := cache.ListSnapshotDates(twd.store, project)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	snapshotDates := entries[0]
+
+	dueDates, err := twd.findDueDates(snapshotDates, project)
+	if err != nil {
+		return nil, err
+	}
+
+	titles, err := twd.epicTitles(snapshotDates, project, dueDates)
+	if err != nil {
+		return nil, err
+	}
+
+	histories := make([]SlipHistory, 0, len(dueDates))
+
+	for key, observed := range dueDates {
+		sort.SliceStable(observed, func(i, j int) bool { return observed[i].ShapshotDate.Before(observed[j].ShapshotDate) })
+
+		history := SlipHistory{
+			Key:       key,
+			Title:     titles[key],
+			FirstSeen: observed[0].ShapshotDate,
+			Initial:   observed[0].DueDate,
+			Current:   observed[len(observed)-1].DueDate,
+			Changes:   make([]DueDateChange, 0),
+		}
+
+		for i := 1; i < len(observed); i++ {
+			if !observed[i].DueDate.Equal(observed[i-1].DueDate) {
+				history.Changes = append(history.Changes, DueDateChange{
+					ObservedAt: observed[i].ShapshotDate,
+					From:       observed[i-1].DueDate,
+					To:         observed[i].DueDate,
+				})
+			}
+		}
+
+		histories = append(histories, history)
+	}
+
+	sort.Slice(histories, func(i, j int) bool { return histories[i].Key < histories[j].Key })
+
+	return histories, nil
+}
+
+// epicTitles returns the epic summaries from the latest snapshot the epics appear in
+func (twd *TimeWindowDiffer) epicTitles(snapshotDates *cache.CachedEntry, project string, keys map[string][]historicDueDate) (map[string]string, error) {
+	dates := append([]string{}, snapshotDates.Dates...)
+	sort.Sort(sort.Reverse(sort.StringSlice(dates)))
+
+	titles := make(map[string]string, len(keys))
+
+	for _, date := range dates {
+		if len(titles) == len(keys) {
+			break
+		}
+
+		t, err := time.Parse(cache.DateFormat, date)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot, err := twd.store.Get(project, t)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, epic := range snapshot.Epics {
+			if _, ok := titles[epic.Key]; !ok && epic.Fields != nil {
+				titles[epic.Key] = epic.Fields.Summary
+			}
+		}
+	}
+
+	return titles, nil
+}
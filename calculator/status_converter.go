@@ -1,11 +1,6 @@
 package calculator
 
 import (
-	"fmt"
-	"os"
-	"sort"
-	"time"
-
 	"github.com/makarski/roadsnap/config"
 )
 
@@ -56,34 +51,3 @@ func (sc StatusConverter) Status(originStatus string) Status {
 
 	return StatusUndefined
 }
-
-func (sc StatusConverter) PlanningStatus(
-	actualStatus Status,
-	snapshotDate time.Time,
-	actualStartDate time.Time,
-	actualDueDate time.Time,
-	historicDueDates []historicDueDate,
-) PlanningStatus {
-	fmt.Fprintln(os.Stderr, "> historicDueDates:", historicDueDates)
-
-	if len(historicDueDates) > 0 {
-		// DESC
-		sort.Slice(historicDueDates, func(i, j int) bool { return historicDueDates[i].DueDate.Unix() > historicDueDates[j].DueDate.Unix() })
-
-		if historicDueDates[0].DueDate.Before(actualDueDate) {
-			return PlanningStatusPostponed
-		}
-
-		if historicDueDates[0].DueDate.After(actualDueDate) {
-			return PlanningStatusAdvanced
-		}
-	}
-
-	pastDueDate := snapshotDate.After(actualDueDate)
-	if (!actualStatus.isDone() && pastDueDate) || (actualStatus.isToDo() && snapshotDate.After(actualStartDate)) {
-		return PlanningStatusOverdue
-	}
-
-	return PlanningStatusOK
-
-}
@@ -2,7 +2,7 @@ package calculator
 
 import (
 	"fmt"
-	"os"
+	"sort"
 	"time"
 
 	"github.com/andygrunwald/go-jira"
@@ -10,28 +10,35 @@ import (
 	"github.com/makarski/roadsnap/cmd/cache"
 )
 
-type (
-	EpicFinder interface {
-		FromCacheOrdered(time.Time, string) ([]*cache.EpicLink, error)
-	}
+type TimeWindowDiffer struct {
+	linkPrefix      string
+	statusConverter StatusConverter
+	estimator       Estimator
+	store           cache.Store
 
-	TimeWindowDiffer struct {
-		linkPrefix      string
-		statusConverter StatusConverter
-		epicFinder      EpicFinder
-		cacheDir        string
-	}
-)
+	// statusHistories are the issue statuses by project, loaded for the issues cached without changelogs
+	statusHistories map[string]map[string][]statusObservation
+	// snapshotsRead are the dates of the snapshots the current report is built from, see: Report2.Snapshots
+	snapshotsRead map[time.Time]bool
+}
 
-func NewTimeWindowDiffer(linkPrefix string, statusConverter StatusConverter, epicFinder EpicFinder, cacheDir string) TimeWindowDiffer {
+func NewTimeWindowDiffer(linkPrefix string, statusConverter StatusConverter, estimator Estimator, store cache.Store) TimeWindowDiffer {
 	return TimeWindowDiffer{
 		linkPrefix:      linkPrefix,
 		statusConverter: statusConverter,
-		epicFinder:      epicFinder,
-		cacheDir:        cacheDir,
+		estimator:       estimator,
+		store:           store,
+		statusHistories: make(map[string]map[string][]statusObservation),
+		snapshotsRead:   make(map[time.Time]bool),
 	}
 }
 
+// readSnapshot returns the cached epics of a snapshot the current report is built from
+func (twd *TimeWindowDiffer) readSnapshot(date time.Time, project string) ([]*cache.EpicLink, error) {
+	twd.snapshotsRead[date] = true
+	return cache.FromCacheOrdered(twd.store, date, project)
+}
+
 type historicDueDate struct {
 	DueDate      time.Time
 	ShapshotDate time.Time
@@ -42,17 +49,29 @@ func (twd *TimeWindowDiffer) findDueDates(
 	snapshotDates *cache.CachedEntry,
 	project string,
 ) (map[string][]historicDueDate, error) {
-	fmt.Fprintln(os.Stderr, "> project cached:", snapshotDates)
-
 	dueDates := make(map[string][]historicDueDate, 0)
 
+	// query the history directly if the store supports it
+	if history, ok := twd.store.(cache.HistoryStore); ok {
+		items, err := history.EpicDueDates(project)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			dueDates[item.Key] = append(dueDates[item.Key], historicDueDate{item.DueDate, item.SnapshotDate, item.Key})
+		}
+
+		return dueDates, nil
+	}
+
 	for _, date := range snapshotDates.Dates {
 		date, err := time.Parse(cache.DateFormat, date)
 		if err != nil {
 			return nil, err
 		}
 
-		epics, err := twd.epicFinder.FromCacheOrdered(date, project)
+		epics, err := cache.FromCacheOrdered(twd.store, date, project)
 		if err != nil {
 			return nil, err
 		}
@@ -65,7 +84,8 @@ func (twd *TimeWindowDiffer) findDueDates(
 	return dueDates, nil
 }
 
-func findSnapshotDatesForPeriod(dates []string, reportFrom, reportTo time.Time) (time.Time, time.Time, error) {
+// FindSnapshotDatesForPeriod returns the snapshot dates a report for the period is built from
+func FindSnapshotDatesForPeriod(dates []string, reportFrom, reportTo time.Time) (time.Time, time.Time, error) {
 	var startSnapshot, endSnapshot, lastSnapshot string
 
 	for _, snapDate := range dates {
@@ -102,15 +122,46 @@ func findSnapshotDatesForPeriod(dates []string, reportFrom, reportTo time.Time)
 	return startSnapDate, endSnapDate, nil
 }
 
+// NextSnapshotDate returns the date of the first snapshot taken after the period end,
+// the period end state may be rewound from it, see: TimeWindowDiffer.rewindToPeriod
+func NextSnapshotDate(dates []string, reportTo time.Time) (time.Time, bool, error) {
+	var nextSnapshot string
+	for _, date := range dates {
+		if date > reportTo.Format(cache.DateFormat) && (nextSnapshot == "" || date < nextSnapshot) {
+			nextSnapshot = date
+		}
+	}
+
+	if nextSnapshot == "" {
+		return time.Time{}, false, nil
+	}
+
+	nextSnapshotDate, err := time.Parse(cache.DateFormat, nextSnapshot)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed parsing next snapdate: %s", err)
+	}
+
+	return nextSnapshotDate, true, nil
+}
+
+// SetEstimator sets the estimator decided for all the report snapshots of a project, see: Estimator.ForSnapshots
+func (twd *TimeWindowDiffer) SetEstimator(estimator Estimator) {
+	twd.estimator = estimator
+}
+
 func (twd *TimeWindowDiffer) Report(project string, reportFrom, reportTo time.Time) (*Report2, error) {
-	projectsSnapshotDates, err := cache.ListSnapshotDates(twd.cacheDir, project)
+	projectsSnapshotDates, err := cache.ListSnapshotDates(twd.store, project)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(projectsSnapshotDates) == 0 {
+		return nil, fmt.Errorf("no snapshots cached for project: %s", project)
+	}
+
 	snapshotDates := projectsSnapshotDates[0]
 
-	startSnapshotDate, endSnapshotDate, err := findSnapshotDatesForPeriod(
+	startSnapshotDate, endSnapshotDate, err := FindSnapshotDatesForPeriod(
 		snapshotDates.Dates,
 		reportFrom,
 		reportTo,
@@ -119,7 +170,9 @@ func (twd *TimeWindowDiffer) Report(project string, reportFrom, reportTo time.Ti
 		return nil, err
 	}
 
-	fromEpics, err := twd.epicFinder.FromCacheOrdered(startSnapshotDate, project)
+	twd.snapshotsRead = make(map[time.Time]bool)
+
+	fromEpics, err := twd.readSnapshot(startSnapshotDate, project)
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +181,7 @@ func (twd *TimeWindowDiffer) Report(project string, reportFrom, reportTo time.Ti
 	if startSnapshotDate.Equal(endSnapshotDate) {
 		toEpics = fromEpics
 	} else {
-		toEpics, err = twd.epicFinder.FromCacheOrdered(endSnapshotDate, project)
+		toEpics, err = twd.readSnapshot(endSnapshotDate, project)
 		if err != nil {
 			return nil, err
 		}
@@ -142,11 +195,76 @@ func (twd *TimeWindowDiffer) Report(project string, reportFrom, reportTo time.Ti
 		SnapshotTo:   endSnapshotDate,
 	}
 
-	twd.writeStats(report, fromEpics, toEpics)
+	if err := twd.rewindToPeriod(report, snapshotDates.Dates, project, &fromEpics, &toEpics); err != nil {
+		return nil, err
+	}
+
+	// all the periods are weighted alike, see: SetEstimator
+	report.Estimator = twd.estimator
+
+	if err := twd.writeStats(report, project, fromEpics, toEpics); err != nil {
+		return nil, err
+	}
+
+	for date := range twd.snapshotsRead {
+		report.Snapshots = append(report.Snapshots, date)
+	}
+	sort.Slice(report.Snapshots, func(i, j int) bool { return report.Snapshots[i].Before(report.Snapshots[j]) })
 
 	return report, nil
 }
 
+// rewindToPeriod replaces the snapshot states with the states at the period boundaries
+// if the snapshots are cached with changelogs. The period start is rewound from the start snapshot,
+// the period end from the first snapshot taken after the period, if any.
+func (twd *TimeWindowDiffer) rewindToPeriod(
+	report *Report2,
+	dates []string,
+	project string,
+	fromEpics, toEpics *[]*cache.EpicLink,
+) error {
+	rewoundFrom, ok, err := epicsAt(*fromEpics, report.From)
+	if !ok || err != nil {
+		return err
+	}
+
+	periodEnd := report.To.AddDate(0, 0, 1).Add(-time.Nanosecond)
+
+	rewoundTo, ok, err := epicsAt(*toEpics, periodEnd)
+	if err != nil {
+		return err
+	}
+
+	nextSnapshotDate, hasNext, err := NextSnapshotDate(dates, report.To)
+	if err != nil {
+		return err
+	}
+
+	if hasNext {
+		nextEpics, err := twd.readSnapshot(nextSnapshotDate, project)
+		if err != nil {
+			return err
+		}
+
+		if rewound, nextOk, err := epicsAt(nextEpics, periodEnd); err != nil {
+			return err
+		} else if nextOk {
+			rewoundTo, ok = rewound, true
+			report.SnapshotTo = nextSnapshotDate
+		}
+	}
+
+	// both snapshots are rewound or none, the states of a report are taken the same way
+	if !ok {
+		return nil
+	}
+
+	*fromEpics, *toEpics = rewoundFrom, rewoundTo
+	report.FromChangelog = true
+
+	return nil
+}
+
 func (twd *TimeWindowDiffer) generateLink(key string) string {
 	return twd.linkPrefix + "/" + key
 }
@@ -184,7 +302,7 @@ func (twd *TimeWindowDiffer) writeToEpicPairs(
 ) {
 	for _, epicState := range stateSlice {
 		epicState := *epicState
-		if epicState.DueDate.Before(report.From) || epicState.DueDate.After(report.To) {
+		if !report.allEpics && (epicState.DueDate.Before(report.From) || epicState.DueDate.After(report.To)) {
 			continue
 		}
 
@@ -195,35 +313,135 @@ func (twd *TimeWindowDiffer) writeToEpicPairs(
 
 		for _, storyState := range epicState.Issues {
 			planStory := twd.toPlanStory(epicState.SnapshotDate, storyState)
+			planStory.Estimate = report.Estimator.Weight(storyState)
 			(&planEpic).PlanStories = append(planEpic.PlanStories, &planStory)
+			(&planEpic).Estimate += planStory.Estimate
 
 			if planStory.Status.isDone() {
 				(&planEpic).StoriesDone += 1
+				(&planEpic).EstimateDone += planStory.Estimate
 			}
 
 			report.IncrStoriesDone(left, planStory.Status, 1)
+			report.IncrEstimate(left, planStory.Status, planStory.Estimate)
 		}
 
 		findAddPair(epicMap, &report.EpicPairs, epicState.Epic.Key, planEpic, left)
 	}
 }
 
-func (twd *TimeWindowDiffer) writeStats(report *Report2, fromState, toState []*cache.EpicLink) {
+func (twd *TimeWindowDiffer) writeStats(report *Report2, project string, fromState, toState []*cache.EpicLink) error {
+	twd.writePairs(report, fromState, toState)
+
+	if err := twd.writeEpicFlowStats(report, project, toState); err != nil {
+		return err
+	}
+
+	return twd.writeFlowStats(report, project, toState)
+}
+
+// writePairs pairs the epics of both states and sets the progress and the scope changes,
+// no snapshots other than the given states are read
+func (twd *TimeWindowDiffer) writePairs(report *Report2, fromState, toState []*cache.EpicLink) {
 	epicPairsMap := make(map[string]*Pair, len(fromState))
 
-	twd.writeToEpicPairs(
-		report,
-		epicPairsMap,
-		fromState,
-		true,
-	)
+	twd.writeToEpicPairs(report, epicPairsMap, fromState, true)
+	twd.writeToEpicPairs(report, epicPairsMap, toState, false)
 
-	twd.writeToEpicPairs(
-		report,
-		epicPairsMap,
-		toState,
-		false,
-	)
+	writeScopeChanges(report, fromState, toState)
+}
+
+// writeEpicFlowStats sets the lead and cycle times of the done stories of the paired end state epics
+func (twd *TimeWindowDiffer) writeEpicFlowStats(report *Report2, project string, toState []*cache.EpicLink) error {
+	pairs := make(map[string]*Pair, len(report.EpicPairs))
+	for _, pair := range report.EpicPairs {
+		pairs[pair.Key] = pair
+	}
+
+	for _, epicState := range toState {
+		pair, ok := pairs[epicState.Epic.Key]
+		if !ok || !pair.hasRight() {
+			continue
+		}
+
+		times, err := twd.flowStats(project, *epicState, endOfDay(epicState.SnapshotDate))
+		if err != nil {
+			return err
+		}
+
+		pair.Right.Flow = newFlowStats(times)
+	}
+
+	return nil
+}
+
+// writeFlowStats sets the lead and cycle times of all the issues done within the report period.
+// The issues missing from the end state, removed or moved out of the cached epics,
+// are taken from the latest snapshot of the period they appear in.
+func (twd *TimeWindowDiffer) writeFlowStats(report *Report2, project string, toState []*cache.EpicLink) error {
+	periodEnd := endOfDay(report.To)
+	doneInPeriod := make([]IssueTimes, 0)
+	seen := make(map[string]bool)
+
+	collect := func(epics []*cache.EpicLink) error {
+		for _, epicState := range epics {
+			epic := *epicState
+			epic.Issues = make([]jira.Issue, 0, len(epicState.Issues))
+
+			for _, issue := range epicState.Issues {
+				if !seen[issue.Key] {
+					seen[issue.Key] = true
+					epic.Issues = append(epic.Issues, issue)
+				}
+			}
+
+			times, err := twd.flowStats(project, epic, endOfDay(epic.SnapshotDate))
+			if err != nil {
+				return err
+			}
+
+			for _, it := range times {
+				if !it.Done.Before(report.From) && !it.Done.After(periodEnd) {
+					doneInPeriod = append(doneInPeriod, it)
+				}
+			}
+		}
+
+		return nil
+	}
+
+	if err := collect(toState); err != nil {
+		return err
+	}
+
+	dates, err := twd.store.ListDates(project)
+	if err != nil {
+		return err
+	}
+
+	for i := len(dates) - 1; i >= 0; i-- {
+		date, err := time.Parse(cache.DateFormat, dates[i])
+		if err != nil {
+			return err
+		}
+
+		if date.Before(report.From) || date.After(report.To) || !date.Before(report.SnapshotTo) {
+			continue
+		}
+
+		epics, err := twd.readSnapshot(date, project)
+		if err != nil {
+			return err
+		}
+
+		if err := collect(epics); err != nil {
+			return err
+		}
+	}
+
+	report.Flow = newFlowStats(doneInPeriod)
+
+	return nil
 }
 
 func (twd *TimeWindowDiffer) toPlanEpic(cached cache.EpicLink) PlanEpic {
@@ -237,17 +455,26 @@ func (twd *TimeWindowDiffer) toPlanEpic(cached cache.EpicLink) PlanEpic {
 		Key:          cached.Epic.Key,
 		Link:         twd.generateLink(cached.Epic.Key),
 		Status:       actualStatus,
+		StatusName:   cached.Epic.Fields.Status.Name,
 	}
 }
 
 func (twd *TimeWindowDiffer) toPlanStory(snapshotDate time.Time, jIssue jira.Issue) PlanStory {
-	return PlanStory{
+	story := PlanStory{
 		SnapshotDate: snapshotDate,
 		Key:          jIssue.Key,
 		Title:        jIssue.Fields.Summary,
 		Link:         twd.generateLink(jIssue.Key),
 		Status:       twd.statusConverter.Status(jIssue.Fields.Status.Name),
+		StatusName:   jIssue.Fields.Status.Name,
+		DueDate:      time.Time(jIssue.Fields.Duedate),
 	}
+
+	if jIssue.Fields.Assignee != nil {
+		story.Assignee = jIssue.Fields.Assignee.DisplayName
+	}
+
+	return story
 }
 
 type (
@@ -257,6 +484,22 @@ type (
 		To           time.Time
 		SnapshotFrom time.Time
 		SnapshotTo   time.Time
+		// FromChangelog is true if the period states are reconstructed from the issue changelogs
+		FromChangelog bool
+		// Snapshots are the dates of all the snapshots the period states and flow stats are read from,
+		// the snapshots within the period and the statuses of the issues cached without changelogs included
+		Snapshots []time.Time
+		// Flow are the lead and cycle times of the issues done within the period
+		Flow FlowStats
+		// Estimator weights the progress, the estimates equal the story counts if not weighted
+		Estimator Estimator
+		// allEpics includes the epics due outside of the period, set for the snapshot diffs
+		allEpics bool
+
+		LeftEstimatePlanned  float64
+		LeftEstimateDone     float64
+		RightEstimatePlanned float64
+		RightEstimateDone    float64
 
 		LeftEpicsPlanned   int
 		LeftEpicsDone      int
@@ -278,6 +521,19 @@ type (
 
 		Left  PlanEpic
 		Right PlanEpic
+
+		// Added and Removed are the stories which joined or left the epic between the snapshots,
+		// Reparented are the stories moved from or to another epic
+		Added      []*PlanStory
+		Removed    []*PlanStory
+		Reparented []*ReparentedStory
+	}
+
+	// ReparentedStory is a story moved between epics, From or To is the paired epic
+	ReparentedStory struct {
+		Story *PlanStory
+		From  string
+		To    string
 	}
 
 	PlanEpic struct {
@@ -288,8 +544,13 @@ type (
 		Key          string
 		Link         string
 		Status       Status
+		StatusName   string
 		PlanStories  []*PlanStory
 		StoriesDone  int
+		Estimate     float64
+		EstimateDone float64
+		// Flow are the lead and cycle times of the done epic stories
+		Flow FlowStats
 	}
 
 	PlanStory struct {
@@ -298,19 +559,25 @@ type (
 		Title        string
 		Link         string
 		Status       Status
+		StatusName   string
+		DueDate      time.Time
+		Assignee     string
+		Estimate     float64
 	}
 )
 
+// Progress is the done estimate out of the planned estimate,
+// out of the right estimate if nothing was planned in the left snapshot
 func (p *Pair) Progress() float64 {
-	if p.hasLeft() && p.hasRight() && p.Right.StoriesDone > 0 {
-		return float64(p.Right.StoriesDone) / float64(len(p.Left.PlanStories))
+	if !p.hasRight() || p.Right.EstimateDone == 0 {
+		return 0
 	}
 
-	if !p.hasLeft() && p.hasRight() && p.Right.StoriesDone > 0 {
-		return float64(p.Right.StoriesDone) / float64(len(p.Right.PlanStories))
+	if p.hasLeft() && p.Left.Estimate > 0 {
+		return p.Right.EstimateDone / p.Left.Estimate
 	}
 
-	return 0
+	return progressRatio(p.Right.EstimateDone, p.Right.Estimate)
 }
 
 func (p *Pair) hasLeft() bool {
@@ -357,12 +624,27 @@ func (p *Pair) leftRightDueDate(format string, left bool) string {
 	return "Rescheduled"
 }
 
+// Progress is the done estimate out of the planned estimate,
+// out of the right estimate if nothing was planned in the left snapshot
 func (r *Report2) Progress() float64 {
-	if r.RightStoriesDone == 0 {
+	if r.RightEstimateDone == 0 {
 		return 0
 	}
 
-	return float64(r.RightStoriesDone) / float64(r.LeftStoriesPlanned)
+	if r.LeftEstimatePlanned > 0 {
+		return r.RightEstimateDone / r.LeftEstimatePlanned
+	}
+
+	return progressRatio(r.RightEstimateDone, r.RightEstimatePlanned)
+}
+
+// progressRatio is the done out of the total, zero if there is nothing to be done
+func progressRatio(done, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+
+	return done / total
 }
 
 func (r *Report2) IncrPlanned(left bool, epicCount, storyCount int) {
@@ -398,3 +680,78 @@ func (r *Report2) IncrStoriesDone(left bool, status Status, count int) {
 		r.RightStoriesDone += count
 	}
 }
+
+func (r *Report2) IncrEstimate(left bool, status Status, estimate float64) {
+	if left {
+		r.LeftEstimatePlanned += estimate
+	} else {
+		r.RightEstimatePlanned += estimate
+	}
+
+	if !status.isDone() {
+		return
+	}
+
+	if left {
+		r.LeftEstimateDone += estimate
+	} else {
+		r.RightEstimateDone += estimate
+	}
+}
+
+// ScopeChange is the net change of the epic stories relative to the left snapshot,
+// zero if the epic is not in both snapshots
+func (p *Pair) ScopeChange() float64 {
+	if !p.hasLeft() || !p.hasRight() || len(p.Left.PlanStories) == 0 {
+		return 0
+	}
+
+	return float64(p.scopeDelta()) / float64(len(p.Left.PlanStories))
+}
+
+// HasScopeChanges is true if any story joined or left the epic
+func (p *Pair) HasScopeChanges() bool {
+	return len(p.Added) > 0 || len(p.Removed) > 0 || len(p.Reparented) > 0
+}
+
+func (p *Pair) scopeDelta() int {
+	delta := len(p.Added) - len(p.Removed)
+	for _, moved := range p.Reparented {
+		if moved.To == p.Key {
+			delta++
+		} else {
+			delta--
+		}
+	}
+
+	return delta
+}
+
+// HasScopeChanges is true if any story joined or left the report epics
+func (r *Report2) HasScopeChanges() bool {
+	for _, pair := range r.EpicPairs {
+		if pair.HasScopeChanges() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ScopeChange is the net change of the stories of the epics in both snapshots
+// relative to their stories in the left snapshot
+func (r *Report2) ScopeChange() float64 {
+	delta, planned := 0, 0
+	for _, pair := range r.EpicPairs {
+		if pair.hasLeft() && pair.hasRight() {
+			delta += pair.scopeDelta()
+			planned += len(pair.Left.PlanStories)
+		}
+	}
+
+	if planned == 0 {
+		return 0
+	}
+
+	return float64(delta) / float64(planned)
+}
@@ -0,0 +1,151 @@
+package calculator
+
+import (
+	"testing"
+
+	"github.com/andygrunwald/go-jira"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+)
+
+func TestRewindToPeriod(t *testing.T) {
+	epic := testChangelogIssue("EP-1", "In Progress", "")
+	started := change{"2026-09-05 10:00", changelogFieldStatus, "To Do", "In Progress"}
+	doneAtPeriodEnd := []change{
+		started,
+		{"2026-09-29 10:00", changelogFieldStatus, "In Progress", "Done"},
+		{"2026-10-02 10:00", changelogFieldStatus, "Done", "In Progress"},
+	}
+
+	tests := []struct {
+		name string
+		// stories are the story states cached in the snapshots by date
+		stories           map[string]jira.Issue
+		wantFromChangelog bool
+		wantSnapshotTo    string
+		wantFrom, wantTo  string
+	}{
+		{
+			name: "end state is rewound from the next snapshot",
+			stories: map[string]jira.Issue{
+				"2026-09-01": testChangelogIssue("ST-1", "To Do", ""),
+				"2026-09-28": testChangelogIssue("ST-1", "In Progress", "", started),
+				"2026-10-03": testChangelogIssue("ST-1", "In Progress", "", doneAtPeriodEnd...),
+				"2026-10-10": testIssue("ST-1", "Done"),
+			},
+			wantFromChangelog: true,
+			wantSnapshotTo:    "2026-10-03",
+			wantFrom:          "To Do",
+			wantTo:            "Done",
+		},
+		{
+			name: "end state is rewound from the end snapshot if the next one has no changelog",
+			stories: map[string]jira.Issue{
+				"2026-09-01": testChangelogIssue("ST-1", "To Do", ""),
+				"2026-09-28": testChangelogIssue("ST-1", "In Progress", "", started),
+				"2026-10-03": testIssue("ST-1", "In Progress"),
+			},
+			wantFromChangelog: true,
+			wantSnapshotTo:    "2026-09-28",
+			wantFrom:          "To Do",
+			wantTo:            "In Progress",
+		},
+		{
+			name: "states are kept if the start snapshot has no changelog",
+			stories: map[string]jira.Issue{
+				"2026-09-01": testIssue("ST-1", "To Do"),
+				"2026-09-28": testChangelogIssue("ST-1", "In Progress", "", started),
+				"2026-10-03": testChangelogIssue("ST-1", "In Progress", "", doneAtPeriodEnd...),
+			},
+			wantSnapshotTo: "2026-09-28",
+			wantFrom:       "To Do",
+			wantTo:         "In Progress",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := cache.NewFSStore(t.TempDir())
+			dates := make([]string, 0, len(tt.stories))
+
+			for date, story := range tt.stories {
+				err := store.Put(&cache.Snapshot{
+					Project: "Project",
+					Date:    mustDate(date),
+					Epics:   []jira.Issue{epic},
+					Issues:  map[string][]jira.Issue{"EP-1": {story}},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				dates = append(dates, date)
+			}
+
+			fromEpics, err := cache.FromCacheOrdered(store, mustDate("2026-09-01"), "Project")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			toEpics, err := cache.FromCacheOrdered(store, mustDate("2026-09-28"), "Project")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			twd := NewTimeWindowDiffer("", testStatusConverter, Estimator{}, store)
+			report := &Report2{
+				From:         mustDate("2026-09-01"),
+				To:           mustDate("2026-09-30"),
+				SnapshotFrom: mustDate("2026-09-01"),
+				SnapshotTo:   mustDate("2026-09-28"),
+			}
+
+			if err := twd.rewindToPeriod(report, dates, "Project", &fromEpics, &toEpics); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if report.FromChangelog != tt.wantFromChangelog {
+				t.Errorf("FromChangelog = %t, want %t", report.FromChangelog, tt.wantFromChangelog)
+			}
+
+			if got := report.SnapshotTo.Format(cache.DateFormat); got != tt.wantSnapshotTo {
+				t.Errorf("SnapshotTo = %s, want %s", got, tt.wantSnapshotTo)
+			}
+
+			if got := fromEpics[0].Issues[0].Fields.Status.Name; got != tt.wantFrom {
+				t.Errorf("start status = %s, want %s", got, tt.wantFrom)
+			}
+
+			if got := toEpics[0].Issues[0].Fields.Status.Name; got != tt.wantTo {
+				t.Errorf("end status = %s, want %s", got, tt.wantTo)
+			}
+
+			// the snapshots after the next one are not read
+			if twd.snapshotsRead[mustDate("2026-10-10")] {
+				t.Error("snapshot after the next one is read")
+			}
+		})
+	}
+}
+
+func TestNextSnapshotDate(t *testing.T) {
+	dates := []string{"2026-09-01", "2026-09-28", "2026-10-03", "2026-10-10"}
+
+	tests := []struct {
+		to     string
+		want   string
+		wantOk bool
+	}{
+		{"2026-09-30", "2026-10-03", true},
+		{"2026-09-28", "2026-10-03", true},
+		{"2026-08-31", "2026-09-01", true},
+		{"2026-10-10", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok, err := NextSnapshotDate(dates, mustDate(tt.to))
+		if err != nil || ok != tt.wantOk || (ok && !got.Equal(mustDate(tt.want))) {
+			t.Errorf("NextSnapshotDate(%s) = %s, %t, %v, want %s, %t", tt.to, got.Format(cache.DateFormat), ok, err, tt.want, tt.wantOk)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/config"
+	"github.com/makarski/roadsnap/util"
+)
+
+func exportFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("export", flag.ExitOnError)
+	fls.StringVar(&ExportArgs.Out, "out", "", "Archive file. Defaults to roadsnap-export-<date>.tar.gz")
+	fls.StringVar(&ExportArgs.Projects, "project", "", "Comma separated projects to export. Defaults to all projects")
+	fls.StringVar(&ExportArgs.From, "from", "", "Export snapshots taken on or after the date (YYYY-MM-DD)")
+	fls.StringVar(&ExportArgs.To, "to", "", "Export snapshots taken on or before the date (YYYY-MM-DD)")
+
+	return fls
+}
+
+// exportCmd packs the selected snapshots into a tar.gz archive
+func exportCmd(cfg *config.Config) CmdFunc {
+	return func() error {
+		selection := cache.ArchiveSelection{}
+
+		if ExportArgs.Projects != "" {
+			for _, project := range strings.Split(ExportArgs.Projects, ",") {
+				selection.Projects = append(selection.Projects, strings.TrimSpace(project))
+			}
+		}
+
+		var err error
+		if selection.From, err = parseDateArg("from", ExportArgs.From); err != nil {
+			return err
+		}
+		if selection.To, err = parseDateArg("to", ExportArgs.To); err != nil {
+			return err
+		}
+
+		outFile := ExportArgs.Out
+		if outFile == "" {
+			outFile = fmt.Sprintf("roadsnap-export-%s.tar.gz", time.Now().Format(dateFormat))
+		}
+
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		var manifest *cache.ArchiveManifest
+
+		err = util.WriteFileAtomic(outFile, func(w io.Writer) error {
+			manifest, err = cache.Export(store, w, selection)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range manifest.Snapshots {
+			fmt.Fprintf(out, "> Exported %s\n", entry)
+		}
+
+		fmt.Fprintf(out, "> Exported %d snapshot(s) to %s\n", len(manifest.Snapshots), outFile)
+
+		return nil
+	}
+}
+
+func importFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("import", flag.ExitOnError)
+	fls.StringVar(&ImportArgs.In, "in", "", "Archive file created by the export subcommand")
+	fls.BoolVar(&ImportArgs.Overwrite, "overwrite", false, "Replace the snapshots which already exist in the cache")
+	fls.BoolVar(&ImportArgs.DryRun, "dry-run", false, "Validate the archive and report the conflicts without importing")
+
+	return fls
+}
+
+// importCmd merges the snapshots of an exported archive into the cache
+func importCmd(cfg *config.Config) CmdFunc {
+	return func() error {
+		if ImportArgs.In == "" {
+			return fmt.Errorf("archive file is not set, use: import -in <file>")
+		}
+
+		f, err := os.Open(ImportArgs.In)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		result, err := cache.Import(store, f, cache.ImportOptions{
+			Overwrite: ImportArgs.Overwrite,
+			DryRun:    ImportArgs.DryRun,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to import: %s. %s", ImportArgs.In, err)
+		}
+
+		conflicts := make(map[string]bool, len(result.Conflicts))
+		for _, entry := range result.Conflicts {
+			conflicts[entry.String()] = true
+
+			if ImportArgs.Overwrite {
+				fmt.Fprintf(out, "> Conflict %s - replaced\n", entry)
+			} else {
+				fmt.Fprintf(out, "> Conflict %s - already cached, skipped\n", entry)
+			}
+		}
+
+		for _, entry := range result.Imported {
+			if !conflicts[entry.String()] {
+				fmt.Fprintf(out, "> Imported %s\n", entry)
+			}
+		}
+
+		verb := "Imported"
+		if ImportArgs.DryRun {
+			verb = "Would import"
+		}
+
+		fmt.Fprintf(out, "> %s %d of %d snapshot(s), %d conflict(s)\n",
+			verb, len(result.Imported), len(result.Manifest.Snapshots), len(result.Conflicts))
+
+		return nil
+	}
+}
+
+func parseDateArg(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(dateFormat, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s date: %s. %s", name, value, err)
+	}
+
+	return t, nil
+}
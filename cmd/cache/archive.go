@@ -0,0 +1,434 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/makarski/roadsnap/util"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+const (
+	// ArchiveManifestName is the archive manifest entry, written last
+	ArchiveManifestName = "archive.json"
+	archiveVersion      = 1
+
+	archiveEpicsName = "epics.json"
+)
+
+// ArchiveManifest lists the snapshots packed in an archive:
+// <Project>/<date>/epics.json
+// <Project>/<date>/issues_<EpicKey>.json
+// <Project>/<date>/manifest.json - the snapshot manifest, if recorded
+type ArchiveManifest struct {
+	ArchiveVersion int            `json:"archive_version"`
+	ToolVersion    string         `json:"tool_version"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Snapshots      []ArchiveEntry `json:"snapshots"`
+}
+
+// ArchiveEntry is a snapshot packed in an archive
+type ArchiveEntry struct {
+	Project string `json:"project"`
+	Date    string `json:"date"`
+	// Files maps the archive entry name to its sha256 checksum
+	Files map[string]string `json:"files"`
+}
+
+func (e ArchiveEntry) String() string {
+	return e.Project + " " + e.Date
+}
+
+// ArchiveSelection selects the exported snapshots, zero values select all
+type ArchiveSelection struct {
+	Projects []string
+	From     time.Time
+	To       time.Time
+}
+
+func (as ArchiveSelection) project(project string) bool {
+	if len(as.Projects) == 0 {
+		return true
+	}
+
+	for _, p := range as.Projects {
+		if util.RemoveSpaces(p) == util.RemoveSpaces(project) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (as ArchiveSelection) date(date time.Time) bool {
+	return (as.From.IsZero() || !date.Before(as.From)) && (as.To.IsZero() || !date.After(as.To))
+}
+
+// Export packs the selected snapshots into a tar.gz archive
+func Export(store Store, w io.Writer, selection ArchiveSelection) (*ArchiveManifest, error) {
+	projects, err := ListSnapshotDates(store, "")
+	if err != nil {
+		return nil, err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	manifest := &ArchiveManifest{
+		ArchiveVersion: archiveVersion,
+		ToolVersion:    ToolVersion,
+		CreatedAt:      time.Now().UTC(),
+		Snapshots:      make([]ArchiveEntry, 0),
+	}
+
+	for _, project := range projects {
+		if !selection.project(project.Project) {
+			continue
+		}
+
+		for _, date := range project.Dates {
+			t, err := time.Parse(DateFormat, date)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse time for project: %s:%s. %s", project.Project, date, err)
+			}
+
+			if !selection.date(t) {
+				continue
+			}
+
+			snapshot, err := store.Get(project.Project, t)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read snapshot: %s %s. %s", project.Project, date, err)
+			}
+
+			entry, err := writeArchiveSnapshot(tw, snapshot, manifest.CreatedAt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to archive snapshot: %s %s. %s", project.Project, date, err)
+			}
+
+			manifest.Snapshots = append(manifest.Snapshots, entry)
+		}
+	}
+
+	if _, err := writeArchiveFile(tw, ArchiveManifestName, manifest, manifest.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return manifest, gw.Close()
+}
+
+func writeArchiveSnapshot(tw *tar.Writer, snapshot *Snapshot, modTime time.Time) (ArchiveEntry, error) {
+	entry := ArchiveEntry{
+		Project: snapshot.Project,
+		Date:    snapshot.Date.Format(DateFormat),
+		Files:   make(map[string]string),
+	}
+
+	dir := path.Join(entry.Project, entry.Date)
+
+	files := []archiveFile{{archiveEpicsName, snapshot.Epics}}
+
+	for _, epic := range snapshot.Epics {
+		issues := snapshot.Issues[epic.Key]
+		if issues == nil {
+			issues = []jira.Issue{}
+		}
+		files = append(files, archiveFile{archiveIssuesName(epic.Key), issues})
+	}
+
+	if snapshot.Manifest != nil {
+		files = append(files, archiveFile{ManifestFileName, snapshot.Manifest})
+	}
+
+	for _, f := range files {
+		name := path.Join(dir, f.name)
+
+		sum, err := writeArchiveFile(tw, name, f.v, modTime)
+		if err != nil {
+			return entry, err
+		}
+
+		entry.Files[name] = sum
+	}
+
+	return entry, nil
+}
+
+type archiveFile struct {
+	name string
+	v    interface{}
+}
+
+func archiveIssuesName(epicKey string) string {
+	return fmt.Sprintf("issues_%s.json", epicKey)
+}
+
+func writeArchiveFile(tw *tar.Writer, name string, v interface{}, modTime time.Time) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(b)),
+		ModTime: modTime,
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return "", err
+	}
+
+	if _, err := tw.Write(b); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ImportOptions controls how the archived snapshots are merged into the store
+type ImportOptions struct {
+	// Overwrite replaces the snapshots which already exist in the store
+	Overwrite bool
+	// DryRun validates the archive and reports the conflicts without storing
+	DryRun bool
+}
+
+// ImportResult reports the imported snapshots and the ones already in the store
+type ImportResult struct {
+	Manifest *ArchiveManifest
+	Imported []ArchiveEntry
+	// Conflicts are the archived snapshots whose dates already exist in the store,
+	// they are imported only with ImportOptions.Overwrite
+	Conflicts []ArchiveEntry
+}
+
+// Import validates a tar.gz archive created by Export and merges its snapshots into the store.
+// Nothing is stored unless the whole archive is valid.
+func Import(store Store, r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	files, err := readArchiveFiles(r)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, snapshots, err := validateArchive(files)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive. %s", err)
+	}
+
+	result := &ImportResult{Manifest: manifest, Imported: make([]ArchiveEntry, 0), Conflicts: make([]ArchiveEntry, 0)}
+	existing := make(map[string][]string)
+
+	for i, entry := range manifest.Snapshots {
+		dates, ok := existing[entry.Project]
+		if !ok {
+			if dates, err = store.ListDates(entry.Project); err != nil {
+				return nil, err
+			}
+			existing[entry.Project] = dates
+		}
+
+		conflict := false
+		for _, date := range dates {
+			conflict = conflict || date == entry.Date
+		}
+
+		if conflict {
+			result.Conflicts = append(result.Conflicts, entry)
+			if !opts.Overwrite {
+				continue
+			}
+		}
+
+		if !opts.DryRun {
+			if err := store.Put(snapshots[i]); err != nil {
+				return nil, fmt.Errorf("failed to store snapshot: %s. %s", entry, err)
+			}
+		}
+
+		result.Imported = append(result.Imported, entry)
+	}
+
+	return result, nil
+}
+
+func readArchiveFiles(r io.Reader) (map[string][]byte, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive. %s", err)
+	}
+	defer gr.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gr)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive. %s", err)
+		}
+
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected archive entry: %s", hdr.Name)
+		}
+
+		if _, ok := files[hdr.Name]; ok {
+			return nil, fmt.Errorf("duplicate archive entry: %s", hdr.Name)
+		}
+
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, tr); err != nil {
+			return nil, fmt.Errorf("failed to read archive entry: %s. %s", hdr.Name, err)
+		}
+
+		files[hdr.Name] = buf.Bytes()
+	}
+
+	return files, nil
+}
+
+// validateArchive checks the archive files against the manifest and decodes the snapshots
+func validateArchive(files map[string][]byte) (*ArchiveManifest, []*Snapshot, error) {
+	b, ok := files[ArchiveManifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("missing %s", ArchiveManifestName)
+	}
+
+	var manifest ArchiveManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s. %s", ArchiveManifestName, err)
+	}
+
+	if manifest.ArchiveVersion < 1 || manifest.ArchiveVersion > archiveVersion {
+		return nil, nil, fmt.Errorf("unsupported archive version: %d", manifest.ArchiveVersion)
+	}
+
+	listed := map[string]bool{ArchiveManifestName: true}
+	seen := make(map[string]bool)
+	snapshots := make([]*Snapshot, 0, len(manifest.Snapshots))
+
+	for _, entry := range manifest.Snapshots {
+		if entry.Project == "" || strings.ContainsAny(entry.Project, `/\`) || strings.HasPrefix(entry.Project, ".") {
+			return nil, nil, fmt.Errorf("invalid project name: `%s`", entry.Project)
+		}
+
+		if seen[entry.String()] {
+			return nil, nil, fmt.Errorf("duplicate snapshot: %s", entry)
+		}
+		seen[entry.String()] = true
+
+		for name, sum := range entry.Files {
+			listed[name] = true
+
+			b, ok := files[name]
+			if !ok {
+				return nil, nil, fmt.Errorf("%s: missing file: %s", entry, name)
+			}
+
+			actual := sha256.Sum256(b)
+			if hex.EncodeToString(actual[:]) != sum {
+				return nil, nil, fmt.Errorf("%s: checksum mismatch: %s", entry, name)
+			}
+		}
+
+		snapshot, err := decodeArchiveSnapshot(entry, files)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", entry, err)
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	unlisted := make([]string, 0)
+	for name := range files {
+		if !listed[name] {
+			unlisted = append(unlisted, name)
+		}
+	}
+
+	if len(unlisted) > 0 {
+		sort.Strings(unlisted)
+		return nil, nil, fmt.Errorf("files not listed in the manifest: %s", strings.Join(unlisted, ", "))
+	}
+
+	return &manifest, snapshots, nil
+}
+
+func decodeArchiveSnapshot(entry ArchiveEntry, files map[string][]byte) (*Snapshot, error) {
+	date, err := time.Parse(DateFormat, entry.Date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot date: %s", err)
+	}
+
+	dir := path.Join(entry.Project, entry.Date)
+	snapshot := &Snapshot{Project: entry.Project, Date: date, Issues: make(map[string][]jira.Issue)}
+
+	decode := func(name string, v interface{}) (bool, error) {
+		name = path.Join(dir, name)
+		if _, ok := entry.Files[name]; !ok {
+			return false, nil
+		}
+
+		if err := json.Unmarshal(files[name], v); err != nil {
+			return false, fmt.Errorf("failed to decode: %s. %s", name, err)
+		}
+
+		return true, nil
+	}
+
+	ok, err := decode(archiveEpicsName, &snapshot.Epics)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("missing file: %s", archiveEpicsName)
+	}
+
+	for _, epic := range snapshot.Epics {
+		var issues []jira.Issue
+
+		ok, err := decode(archiveIssuesName(epic.Key), &issues)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("missing issues of epic: %s", epic.Key)
+		}
+
+		snapshot.Issues[epic.Key] = issues
+	}
+
+	var manifest Manifest
+	if ok, err := decode(ManifestFileName, &manifest); err != nil {
+		return nil, err
+	} else if ok {
+		snapshot.Manifest = &manifest
+	}
+
+	return snapshot, nil
+}
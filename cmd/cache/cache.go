@@ -3,15 +3,13 @@ package cache
 import (
 	"encoding/json"
 	"fmt"
-	"io/fs"
-	"os"
-	"path"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/makarski/roadsnap/config"
 	"github.com/makarski/roadsnap/roadmap"
-	"github.com/makarski/roadsnap/util"
 
 	"github.com/andygrunwald/go-jira"
 )
@@ -21,56 +19,115 @@ const DateFormat = "2006-01-02"
 var CustomFieldStartDate = ""
 
 type EpicCacher struct {
-	rv           *roadmap.RoadmapViewer
-	baseDir      string
-	projCacheDir func(string, time.Time) string
+	rv    *roadmap.RoadmapViewer
+	store Store
+	opts  CacheOptions
 }
 
-func NewEpicCacher(rv *roadmap.RoadmapViewer, dir string) *EpicCacher {
+// CacheOptions controls how the snapshots are fetched and recorded
+type CacheOptions struct {
+	// Concurrency is the number of epics whose issues are fetched in parallel
+	Concurrency int
+	// Resume defines whether a partial snapshot of the same date is resumed or discarded
+	Resume bool
+	// StatusNames is the status mapping recorded in the snapshot manifest
+	StatusNames *config.StatusNames
+}
+
+func NewEpicCacher(rv *roadmap.RoadmapViewer, store Store) *EpicCacher {
 	return &EpicCacher{
 		rv,
-		dir,
-		func(project string, snapshotDate time.Time) string {
-			return path.Join(dir, util.RemoveSpaces(project), snapshotDate.Format(DateFormat), "raw_data")
-		},
+		store,
+		CacheOptions{Concurrency: 1, Resume: true},
 	}
 }
 
-func (ec *EpicCacher) cacheNameEpic(date time.Time, project string) string {
-	projectKey := util.RemoveSpaces(project)
-
-	epicFileKey := fmt.Sprintf("epics_%s.json", projectKey)
-	//todo: remove projectKey
+func (ec *EpicCacher) SetOptions(opts CacheOptions) {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
 
-	return path.Join(ec.projCacheDir(project, date), projectKey, epicFileKey)
+	ec.opts = opts
 }
 
-func (ec *EpicCacher) cacheNameIssues(date time.Time, project, epicKey string) string {
-	//todo: remove projectKey
-
-	return path.Join(ec.projCacheDir(project, date), util.RemoveSpaces(project), fmt.Sprintf("issues_%s.json", epicKey))
-}
+// Cache fetches the project snapshots. Each snapshot is staged in the store
+// and committed only once all the epics are cached.
+func (ec *EpicCacher) Cache(date time.Time, projects []config.Project) error {
+	for _, project := range projects {
+		w, err := ec.store.Stage(project.Name, date, ec.opts.Resume)
+		if err != nil {
+			return err
+		}
 
-func (ec *EpicCacher) Cache(date time.Time, projects []string) error {
-	for _, projectName := range projects {
-		epics, err := ec.cacheEpics(date, projectName)
+		epics, err := ec.cacheEpics(w, project)
 		if err != nil {
 			return err
 		}
 
-		for _, epic := range epics {
-			issues, err := ec.cacheEpicIssues(date, projectName, epic.Key)
-			if err != nil {
-				return err
+		failed := make([]string, 0)
+		issueCount := 0
+
+		// results are reported in the epic order regardless of the fetch order
+		for i, result := range ec.cacheAllEpicIssues(w, project, epics) {
+			if result.err != nil {
+				fmt.Printf("> failed to cache issues for epic: %s. %s\n", epics[i].Key, result.err)
+				failed = append(failed, epics[i].Key)
+				continue
 			}
 
-			fmt.Printf("> cached %d issues for epic: %s\n", len(issues), epic.Fields.Summary)
+			issueCount += result.count
+			fmt.Printf("> cached %d issues for epic: %s\n", result.count, epics[i].Fields.Summary)
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to cache issues for project: %s, epics: %s. partial snapshot is kept for resume",
+				project.Name, strings.Join(failed, ", "))
+		}
+
+		manifest := ec.newManifest(date, project, len(epics), issueCount)
+		if err := w.Commit(manifest); err != nil {
+			return fmt.Errorf("failed to commit snapshot for project: %s. %s", project.Name, err)
 		}
 	}
 
 	return nil
 }
 
+type epicIssuesResult struct {
+	count int
+	err   error
+}
+
+// cacheAllEpicIssues fetches and caches the epic issues using a bounded worker pool.
+// A failed epic does not stop the others, results are indexed as the input epics.
+func (ec *EpicCacher) cacheAllEpicIssues(w SnapshotWriter, project config.Project, epics []jira.Issue) []epicIssuesResult {
+	results := make([]epicIssuesResult, len(epics))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for n := 0; n < ec.opts.Concurrency; n++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				issues, err := ec.cacheEpicIssues(w, project, epics[i].Key)
+				results[i] = epicIssuesResult{len(issues), err}
+			}
+		}()
+	}
+
+	for i := range epics {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
 type EpicLink struct {
 	SnapshotDate time.Time
 	StartDate    time.Time
@@ -79,6 +136,46 @@ type EpicLink struct {
 	Issues       []jira.Issue
 }
 
+// NewEpicLink returns the epic link for the epic issue with the planning dates set.
+// The start date is read from the custom field, if configured.
+func NewEpicLink(epicIssue jira.Issue) (*EpicLink, error) {
+	el := &EpicLink{Epic: epicIssue}
+	if epicIssue.Fields == nil {
+		return el, nil
+	}
+
+	el.DueDate = time.Time(epicIssue.Fields.Duedate)
+
+	// return is custom field for start date not defined
+	if CustomFieldStartDate == "" {
+		return el, nil
+	}
+
+	rawStartDate, ok := epicIssue.Fields.Unknowns[CustomFieldStartDate]
+	if !ok || rawStartDate == nil {
+		return el, nil
+	}
+
+	startDateStr, ok := rawStartDate.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected `%s` value: %v", CustomFieldStartDate, rawStartDate)
+	}
+
+	// undated epics are cached with the include_undated option
+	if strings.TrimSpace(startDateStr) == "" {
+		return el, nil
+	}
+
+	sd, err := time.Parse("2006-01-02", startDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse start time: %s", err)
+	}
+
+	el.StartDate = sd
+
+	return el, nil
+}
+
 func (el *EpicLink) PastDueDate() bool {
 	return el.SnapshotDate.After(el.DueDate)
 }
@@ -99,67 +196,35 @@ func (el *EpicLink) UnmarshalJSON(b []byte) error {
 		return fmt.Errorf(errFmt, fmt.Sprintf("failed to unmarshal jira issue: %s", err))
 	}
 
-	el.Epic = epicIssue
-	el.DueDate = time.Time(epicIssue.Fields.Duedate)
-
-	// return is custom field for start date not defined
-	if CustomFieldStartDate == "" {
-		return nil
-	}
-
-	var raw map[string]json.RawMessage
-	if err := json.Unmarshal(b, &raw); err != nil {
-		return fmt.Errorf(errFmt, fmt.Sprintf("failed to unmarshal raw object: %s", err))
-	}
-
-	var rawFields map[string]json.RawMessage
-	if err := json.Unmarshal(raw["fields"], &rawFields); err != nil {
-		return fmt.Errorf(errFmt, fmt.Sprintf("failed to unmarshal rawFields: %s", err))
-	}
-
-	var startDateStr string
-	if err := json.Unmarshal(rawFields[CustomFieldStartDate], &startDateStr); err != nil {
-		return fmt.Errorf(errFmt, fmt.Sprintf("failed to unmarshal `%s`: %s", CustomFieldStartDate, err))
-	}
-
-	sd, err := time.Parse("2006-01-02", startDateStr)
+	link, err := NewEpicLink(epicIssue)
 	if err != nil {
-		return fmt.Errorf(errFmt, fmt.Sprintf("failed to parse start time: %s", err))
+		return fmt.Errorf(errFmt, err)
 	}
 
-	el.StartDate = sd
+	*el = *link
 
 	return nil
 }
 
 // FromCacheOrdered returns cached epic link items order by DueDate ASC
-func (ec *EpicCacher) FromCacheOrdered(date time.Time, projectName string) ([]*EpicLink, error) {
-	f, err := os.Open(ec.cacheNameEpic(date, projectName))
-	defer f.Close()
+func FromCacheOrdered(store Store, date time.Time, projectName string) ([]*EpicLink, error) {
+	snapshot, err := store.Get(projectName, date)
 	if err != nil {
 		return nil, err
 	}
 
-	var epicLinks []*EpicLink
-	if err := json.NewDecoder(f).Decode(&epicLinks); err != nil {
-		return nil, err
-	}
+	epicLinks := make([]*EpicLink, 0, len(snapshot.Epics))
 
-	for _, epic := range epicLinks {
-		f, err := os.Open(ec.cacheNameIssues(date, projectName, epic.Epic.Key))
+	for _, epicIssue := range snapshot.Epics {
+		epic, err := NewEpicLink(epicIssue)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read cached issues for epic: %s. %s", epic.Epic.Key, err)
+			return nil, fmt.Errorf("failed to read cached epic: %s. %s", epicIssue.Key, err)
 		}
 
-		var issues []jira.Issue
-		if err := json.NewDecoder(f).Decode(&issues); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal issues for epic: %s. %s", epic.Epic.Key, err)
-		}
-
-		f.Close()
-
-		epic.Issues = issues
+		epic.Issues = snapshot.Issues[epicIssue.Key]
 		epic.SnapshotDate = date
+
+		epicLinks = append(epicLinks, epic)
 	}
 
 	// order by due date ASC
@@ -170,36 +235,46 @@ func (ec *EpicCacher) FromCacheOrdered(date time.Time, projectName string) ([]*E
 	return epicLinks, nil
 }
 
-func (ec *EpicCacher) cacheEpics(date time.Time, projectName string) ([]jira.Issue, error) {
-	epics, err := ec.rv.ListEpics(projectName)
+func (ec *EpicCacher) cacheEpics(w SnapshotWriter, project config.Project) ([]jira.Issue, error) {
+	epics, ok, err := w.Epics()
 	if err != nil {
 		return nil, err
 	}
 
-	fileKey := ec.cacheNameEpic(date, projectName)
-	f, err := util.CreateFile(fileKey)
+	if ok {
+		fmt.Printf("> resuming partial snapshot for project: %s\n", project.Name)
+		return epics, nil
+	}
+
+	epics, total, err := ec.rv.ListEpics(project)
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.NewEncoder(f).Encode(epics)
-	return epics, err
+	// an issue moved across the pages is fetched twice, only a short result fails the snapshot
+	if len(epics) < total {
+		return nil, fmt.Errorf("fetched %d out of %d epics for project: %s", len(epics), total, project.Name)
+	}
+
+	return epics, w.PutEpics(epics)
 }
 
-func (ec *EpicCacher) cacheEpicIssues(date time.Time, project, key string) ([]jira.Issue, error) {
-	issues, err := ec.rv.ListEpicIssues(key)
-	if err != nil {
-		return nil, err
+func (ec *EpicCacher) cacheEpicIssues(w SnapshotWriter, project config.Project, key string) ([]jira.Issue, error) {
+	issues, ok, err := w.Issues(key)
+	if ok || err != nil {
+		return issues, err
 	}
 
-	fileKey := ec.cacheNameIssues(date, project, key)
-	f, err := util.CreateFile(fileKey)
+	issues, total, err := ec.rv.ListEpicIssues(project, key)
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.NewEncoder(f).Encode(issues)
-	return issues, err
+	if len(issues) < total {
+		return nil, fmt.Errorf("fetched %d out of %d issues for epic: %s", len(issues), total, key)
+	}
+
+	return issues, w.PutIssues(key, issues)
 }
 
 type CachedEntry struct {
@@ -207,45 +282,30 @@ type CachedEntry struct {
 	Dates   []string
 }
 
-func ListSnapshotDates(baseDir string, project string) ([]*CachedEntry, error) {
-	records := make([]*CachedEntry, 0)
-	byProject := make(map[string]*CachedEntry)
-
-	pattern := "*/*/raw_data"
-	if project != "" {
-		pattern = fmt.Sprintf("%s/*/raw_data", util.RemoveSpaces(project))
-	}
-
-	fs.WalkDir(os.DirFS(baseDir), ".", func(p string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+// ListSnapshotDates returns the snapshot dates by project, all projects if project is empty
+func ListSnapshotDates(store Store, project string) ([]*CachedEntry, error) {
+	projects := []string{project}
+	if project == "" {
+		var err error
+		if projects, err = store.ListProjects(); err != nil {
+			return nil, err
 		}
+	}
 
-		if !d.IsDir() {
-			return nil
-		}
+	records := make([]*CachedEntry, 0, len(projects))
 
-		match, err := path.Match(pattern, p)
+	for _, p := range projects {
+		dates, err := store.ListDates(p)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if !match {
-			return nil
+		if len(dates) == 0 {
+			continue
 		}
 
-		pathData := strings.SplitN(path.Dir(p), "/", 2)
-
-		if bp, ok := byProject[pathData[0]]; ok {
-			bp.Dates = append(bp.Dates, pathData[1])
-		} else {
-			record := &CachedEntry{pathData[0], []string{pathData[1]}}
-			byProject[pathData[0]] = record
-			records = append(records, record)
-		}
-
-		return nil
-	})
+		records = append(records, &CachedEntry{p, dates})
+	}
 
 	return records, nil
 }
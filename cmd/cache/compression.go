@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the codec of the cached files, identified by the file extension
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// compressions lists the codecs tried when reading a cached file
+var compressions = []Compression{CompressionNone, CompressionGzip, CompressionZstd}
+
+func ParseCompression(s string) (Compression, error) {
+	switch Compression(s) {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip, CompressionZstd:
+		return Compression(s), nil
+	}
+
+	return "", fmt.Errorf("unsupported compression: `%s`. expected one of: %s, %s, %s",
+		s, CompressionNone, CompressionGzip, CompressionZstd)
+}
+
+func (c Compression) ext() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+
+	return ""
+}
+
+func (c Compression) writer(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	}
+
+	return nopWriteCloser{w}, nil
+}
+
+func (c Compression) reader(r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+
+	return io.NopCloser(r), nil
+}
+
+// compressionByFileKey returns the codec of a cached file by its extension
+func compressionByFileKey(fileKey string) Compression {
+	for _, c := range compressions {
+		if c != CompressionNone && strings.HasSuffix(fileKey, c.ext()) {
+			return c
+		}
+	}
+
+	return CompressionNone
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
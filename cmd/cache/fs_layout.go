@@ -0,0 +1,413 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/makarski/roadsnap/util"
+)
+
+const (
+	// layoutFileName is the marker file in the work dir holding the layout version
+	layoutFileName = "layout_version"
+	// migratingSuffix marks a snapshot which is being rebuilt in the current layout
+	migratingSuffix = ".migrating"
+)
+
+// Layout is the version of the snapshot directory layout
+type Layout int
+
+const (
+	// LayoutV1 nests the snapshot files in a redundant project dir:
+	// <Project>/<date>/raw_data/<Project>/epics_<Project>.json
+	// <Project>/<date>/raw_data/<Project>/issues_<EpicKey>.json
+	LayoutV1 Layout = 1
+	// LayoutV2 keeps the snapshot files directly in raw_data:
+	// <Project>/<date>/raw_data/epics.json
+	// <Project>/<date>/raw_data/issues_<EpicKey>.json
+	LayoutV2 Layout = 2
+
+	CurrentLayout = LayoutV2
+)
+
+func (l Layout) dataDir(rawDir, project string) string {
+	if l == LayoutV1 {
+		return path.Join(rawDir, util.RemoveSpaces(project))
+	}
+
+	return rawDir
+}
+
+func epicFileKey(l Layout, rawDir, project string) string {
+	if l == LayoutV1 {
+		return path.Join(l.dataDir(rawDir, project), fmt.Sprintf("epics_%s.json", util.RemoveSpaces(project)))
+	}
+
+	return path.Join(rawDir, "epics.json")
+}
+
+func issuesFileKey(l Layout, rawDir, project, epicKey string) string {
+	return path.Join(l.dataDir(rawDir, project), fmt.Sprintf("issues_%s.json", epicKey))
+}
+
+func issueRefsFileKey(l Layout, rawDir, project, epicKey string) string {
+	return path.Join(l.dataDir(rawDir, project), fmt.Sprintf("issues_%s.refs.json", epicKey))
+}
+
+// detectLayout returns the layout of a snapshot dir, fallback if the dir holds no snapshot files
+func detectLayout(rawDir, project string, fallback Layout) Layout {
+	if info, err := os.Stat(LayoutV1.dataDir(rawDir, project)); err == nil && info.IsDir() {
+		return LayoutV1
+	}
+
+	for _, c := range compressions {
+		if _, err := os.Stat(epicFileKey(LayoutV2, rawDir, project) + c.ext()); err == nil {
+			return LayoutV2
+		}
+	}
+
+	return fallback
+}
+
+// LayoutVersion returns the layout version of the work dir.
+// A dir with snapshots and no version marker predates versioning and is LayoutV1.
+func (s *FSStore) LayoutVersion() (Layout, bool, error) {
+	b, err := os.ReadFile(path.Join(s.baseDir, layoutFileName))
+	if err == nil {
+		v, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil || v < int(LayoutV1) || v > int(CurrentLayout) {
+			return 0, true, fmt.Errorf("unsupported cache layout version: `%s`", strings.TrimSpace(string(b)))
+		}
+
+		return Layout(v), true, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return 0, false, err
+	}
+
+	projects, err := s.ListProjects()
+	if err != nil {
+		return 0, false, err
+	}
+
+	if len(projects) > 0 {
+		return LayoutV1, false, nil
+	}
+
+	return CurrentLayout, false, nil
+}
+
+// writeLayout returns the layout new snapshots are written in.
+// The version marker is created for a new work dir.
+func (s *FSStore) writeLayout() (Layout, error) {
+	layout, marked, err := s.LayoutVersion()
+	if err != nil || marked {
+		return layout, err
+	}
+
+	if layout == CurrentLayout {
+		return layout, s.writeLayoutVersion(layout)
+	}
+
+	return layout, nil
+}
+
+func (s *FSStore) writeLayoutVersion(layout Layout) error {
+	return util.WriteFileAtomic(path.Join(s.baseDir, layoutFileName), func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, int(layout))
+		return err
+	})
+}
+
+// LayoutMigrator is implemented by the stores with a versioned layout
+type LayoutMigrator interface {
+	MigrateLayout(dryRun bool) ([]string, error)
+}
+
+// MigrateLayout upgrades all the snapshots to the current layout and returns the applied changes.
+// Each snapshot is rebuilt in a separate dir with hard links and swapped in place,
+// an interrupted migration leaves every snapshot either in the old or in the new layout
+// and the swapped out snapshots are put back by the next run.
+func (s *FSStore) MigrateLayout(dryRun bool) ([]string, error) {
+	changes, err := s.restoreInterrupted(dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	from, _, err := s.LayoutVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	projects, err := s.ListProjects()
+	if err != nil {
+		return nil, err
+	}
+
+	partials, err := s.migratePartials(dryRun)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, partials...)
+
+	for _, project := range projects {
+		projectDir := path.Join(s.baseDir, project)
+
+		dates, err := s.ListDates(project)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, date := range dates {
+			rawDir := path.Join(projectDir, date, rawDataDir)
+			if detectLayout(rawDir, project, CurrentLayout) != LayoutV1 {
+				continue
+			}
+
+			moved, err := migrateSnapshotV1(rawDir, project, dryRun)
+			if err != nil {
+				return nil, fmt.Errorf("failed to migrate snapshot: %s. %s", rawDir, err)
+			}
+
+			for _, m := range moved {
+				changes = append(changes, fmt.Sprintf("%s: %s", s.relPath(rawDir), m))
+			}
+		}
+	}
+
+	if from != CurrentLayout || len(changes) > 0 {
+		changes = append(changes, fmt.Sprintf("layout version: %d -> %d", from, CurrentLayout))
+	}
+
+	if dryRun {
+		return changes, nil
+	}
+
+	return changes, s.writeLayoutVersion(CurrentLayout)
+}
+
+// restoreInterrupted puts back the snapshots and the partial snapshots swapped out
+// by an interrupted migration and removes the dirs it left half-built
+func (s *FSStore) restoreInterrupted(dryRun bool) ([]string, error) {
+	changes := make([]string, 0)
+
+	for _, dir := range []string{rawDataDir, rawDataDir + stagingSuffix} {
+		backups, err := filepath.Glob(path.Join(s.baseDir, "*", "*", dir+backupSuffix))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, backup := range backups {
+			if dryRun {
+				if _, err := os.Stat(strings.TrimSuffix(backup, backupSuffix)); os.IsNotExist(err) {
+					changes = append(changes, fmt.Sprintf("%s: restore interrupted migration", s.relPath(backup)))
+				}
+				continue
+			}
+
+			if err := restoreBackup(backup); err != nil {
+				return nil, fmt.Errorf("failed to restore snapshot: %s. %s", backup, err)
+			}
+		}
+
+		stale, err := filepath.Glob(path.Join(s.baseDir, "*", "*", dir+migratingSuffix))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dir := range stale {
+			if dryRun {
+				continue
+			}
+
+			if err := os.RemoveAll(dir); err != nil {
+				return nil, fmt.Errorf("failed to remove interrupted migration: %s. %s", dir, err)
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// migratePartials upgrades the partial snapshots of interrupted cache runs in place,
+// so that a resumed run commits them in the current layout
+func (s *FSStore) migratePartials(dryRun bool) ([]string, error) {
+	dirs, err := filepath.Glob(path.Join(s.baseDir, "*", "*", rawDataDir+stagingSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]string, 0)
+
+	for _, dir := range dirs {
+		project := path.Base(path.Dir(path.Dir(dir)))
+		if detectLayout(dir, project, CurrentLayout) != LayoutV1 {
+			continue
+		}
+
+		moved, err := migrateSnapshotV1(dir, project, dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate partial snapshot: %s. %s", dir, err)
+		}
+
+		for _, m := range moved {
+			changes = append(changes, fmt.Sprintf("%s: %s", s.relPath(dir), m))
+		}
+	}
+
+	return changes, nil
+}
+
+func (s *FSStore) relPath(p string) string {
+	if rel, err := filepath.Rel(s.baseDir, p); err == nil {
+		return rel
+	}
+
+	return p
+}
+
+// migrateSnapshotV1 moves the files out of the project dir nested in raw_data.
+// Other files of raw_data are carried over, a snapshot with unknown dirs is not migrated.
+func migrateSnapshotV1(rawDir, project string, dryRun bool) ([]string, error) {
+	dataDir := LayoutV1.dataDir(rawDir, project)
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	renames := make(map[string]string, len(entries))
+	moved := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+
+		if entry.IsDir() {
+			return nil, fmt.Errorf("unexpected dir: %s", path.Join(dataDir, entry.Name()))
+		}
+
+		name := entry.Name()
+		newName := name
+
+		v1EpicsName := path.Base(epicFileKey(LayoutV1, rawDir, project))
+		if strings.HasPrefix(name, v1EpicsName) {
+			newName = path.Base(epicFileKey(LayoutV2, rawDir, project)) + strings.TrimPrefix(name, v1EpicsName)
+		}
+
+		renames[path.Join(util.RemoveSpaces(project), name)] = newName
+		moved = append(moved, fmt.Sprintf("%s/%s -> %s", util.RemoveSpaces(project), name, newName))
+	}
+
+	rawEntries, err := os.ReadDir(rawDir)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]string, 0)
+	for _, entry := range rawEntries {
+		name := entry.Name()
+		if name == path.Base(dataDir) || strings.HasPrefix(name, ManifestFileName) || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+
+		if entry.IsDir() {
+			return nil, fmt.Errorf("unexpected dir: %s", path.Join(rawDir, name))
+		}
+
+		for _, newName := range renames {
+			if newName == name {
+				return nil, fmt.Errorf("file conflicts with a migrated file: %s", path.Join(rawDir, name))
+			}
+		}
+
+		kept = append(kept, name)
+	}
+
+	sort.Strings(moved)
+
+	if dryRun {
+		return moved, nil
+	}
+
+	migrating := rawDir + migratingSuffix
+	if err := os.RemoveAll(migrating); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(migrating, os.FileMode(0744)); err != nil {
+		return nil, err
+	}
+
+	for oldName, newName := range renames {
+		if err := linkOrCopy(path.Join(rawDir, oldName), path.Join(migrating, newName)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range kept {
+		if err := linkOrCopy(path.Join(rawDir, name), path.Join(migrating, name)); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest, ok, err := ReadManifest(rawDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		files := make(map[string]string, len(manifest.Files))
+		for name, sum := range manifest.Files {
+			if newName, ok := renames[name]; ok {
+				name = newName
+			}
+			files[name] = sum
+		}
+
+		manifest.Files = files
+		if err := writeManifestFile(migrating, manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	backup := rawDir + backupSuffix
+	if err := os.Rename(rawDir, backup); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(migrating, rawDir); err != nil {
+		err = fmt.Errorf("failed to commit migrated snapshot: %s. %s", rawDir, err)
+		if rErr := restoreBackup(backup); rErr != nil {
+			return nil, fmt.Errorf("%s. failed to restore the replaced snapshot: %s", err, rErr)
+		}
+		return nil, err
+	}
+
+	return moved, os.RemoveAll(backup)
+}
+
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return util.WriteFileAtomic(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
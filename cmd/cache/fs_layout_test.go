@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+var layoutTestDate = time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+
+// putSnapshotV1 stores a snapshot in a work dir marked with LayoutV1
+func putSnapshotV1(t *testing.T, dir string) (*FSStore, *Snapshot) {
+	store := NewFSStore(dir)
+	if err := store.writeLayoutVersion(LayoutV1); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := &Snapshot{
+		Project: "Project",
+		Date:    layoutTestDate,
+		Epics:   []jira.Issue{{Key: "EP-1"}, {Key: "EP-2"}},
+		Issues: map[string][]jira.Issue{
+			"EP-1": {{Key: "ST-1"}, {Key: "ST-2"}},
+			"EP-2": {{Key: "ST-3"}},
+		},
+	}
+
+	if err := store.Put(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	rawDir := store.rawDir("Project", layoutTestDate)
+	if _, err := os.Stat(path.Join(rawDir, "Project", "epics_Project.json")); err != nil {
+		t.Fatalf("snapshot not stored in LayoutV1: %s", err)
+	}
+
+	return store, snapshot
+}
+
+// checkMigrated asserts the snapshot is listed, stored in the current layout and intact
+func checkMigrated(t *testing.T, store *FSStore, want *Snapshot) {
+	rawDir := store.rawDir("Project", layoutTestDate)
+
+	layout, marked, err := store.LayoutVersion()
+	if err != nil || !marked || layout != CurrentLayout {
+		t.Errorf("LayoutVersion = %d, %t, %v, want %d", layout, marked, err, CurrentLayout)
+	}
+
+	dates, err := store.ListDates("Project")
+	if err != nil || !reflect.DeepEqual(dates, []string{"2026-10-17"}) {
+		t.Fatalf("ListDates = %v, %v, want [2026-10-17]", dates, err)
+	}
+
+	if got := detectLayout(rawDir, "Project", 0); got != CurrentLayout {
+		t.Errorf("detectLayout = %d, want %d", got, CurrentLayout)
+	}
+
+	got, err := store.Get("Project", layoutTestDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(issueKeys(got.Epics), issueKeys(want.Epics)) {
+		t.Errorf("epics = %v, want %v", issueKeys(got.Epics), issueKeys(want.Epics))
+	}
+
+	for key, issues := range want.Issues {
+		if !reflect.DeepEqual(issueKeys(got.Issues[key]), issueKeys(issues)) {
+			t.Errorf("issues of %s = %v, want %v", key, issueKeys(got.Issues[key]), issueKeys(issues))
+		}
+	}
+
+	result, err := store.Verify("Project", layoutTestDate)
+	if err != nil || !result.OK() {
+		t.Errorf("Verify = %v, %v, want no problems", result, err)
+	}
+
+	for _, suffix := range []string{backupSuffix, migratingSuffix} {
+		if _, err := os.Stat(rawDir + suffix); !os.IsNotExist(err) {
+			t.Errorf("%s is left behind", rawDir+suffix)
+		}
+	}
+}
+
+func issueKeys(issues []jira.Issue) []string {
+	keys := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		keys = append(keys, issue.Key)
+	}
+
+	return keys
+}
+
+func TestMigrateLayoutV1(t *testing.T) {
+	store, snapshot := putSnapshotV1(t, t.TempDir())
+
+	rawDir := store.rawDir("Project", layoutTestDate)
+	if err := os.WriteFile(path.Join(rawDir, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := store.MigrateLayout(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) == 0 || detectLayout(rawDir, "Project", 0) != LayoutV1 {
+		t.Fatalf("dry run changes = %v, want the changes listed and the snapshot left in LayoutV1", changes)
+	}
+
+	if _, err := store.MigrateLayout(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := os.ReadFile(path.Join(rawDir, "notes.txt")); err != nil || string(b) != "notes" {
+		t.Errorf("notes.txt = %q, %v, want the file carried over", b, err)
+	}
+
+	// the carried over file is not in the manifest
+	if err := os.Remove(path.Join(rawDir, "notes.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	checkMigrated(t, store, snapshot)
+
+	changes, err = store.MigrateLayout(false)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("second migration = %v, %v, want no changes", changes, err)
+	}
+}
+
+func TestMigrateLayoutInterruptedSwap(t *testing.T) {
+	store, snapshot := putSnapshotV1(t, t.TempDir())
+
+	// the migration was interrupted after the snapshot was swapped out
+	rawDir := store.rawDir("Project", layoutTestDate)
+	if err := os.Rename(rawDir, rawDir+backupSuffix); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(path.Join(rawDir+migratingSuffix, "half-built"), 0744); err != nil {
+		t.Fatal(err)
+	}
+
+	if dates, _ := store.ListDates("Project"); len(dates) != 0 {
+		t.Fatalf("ListDates = %v, want the swapped out snapshot not listed", dates)
+	}
+
+	if _, err := store.MigrateLayout(false); err != nil {
+		t.Fatal(err)
+	}
+
+	checkMigrated(t, store, snapshot)
+}
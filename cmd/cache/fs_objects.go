@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/andygrunwald/go-jira"
+
+	"github.com/makarski/roadsnap/util"
+)
+
+const objectsDirName = "objects"
+
+// GarbageCollector is implemented by the stores which share data between snapshots
+// and need to remove the unreferenced data once snapshots are deleted
+type GarbageCollector interface {
+	GC(project string) (int, error)
+}
+
+// readIssues reads the epic issues either from the object refs or from the plain issues file
+func (s *FSStore) readIssues(layout Layout, rawDir, project, epicKey string) ([]jira.Issue, bool, error) {
+	var refs []string
+	ok, err := readCached(issueRefsFileKey(layout, rawDir, project, epicKey), &refs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !ok {
+		var issues []jira.Issue
+		ok, err := readCached(issuesFileKey(layout, rawDir, project, epicKey), &issues)
+
+		return issues, ok, err
+	}
+
+	issues := make([]jira.Issue, 0, len(refs))
+	for _, hash := range refs {
+		issue, err := s.readObject(project, hash)
+		if err != nil {
+			return nil, false, err
+		}
+
+		issues = append(issues, issue)
+	}
+
+	return issues, true, nil
+}
+
+// writeIssues writes the epic issues as objects and their refs if dedup is enabled,
+// otherwise as a plain issues file
+func (s *FSStore) writeIssues(layout Layout, rawDir, project, epicKey string, issues []jira.Issue) error {
+	if !s.opts.Dedup {
+		return writeCached(issuesFileKey(layout, rawDir, project, epicKey), issues, s.opts.Compression)
+	}
+
+	refs := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		hash, err := s.writeObject(project, issue)
+		if err != nil {
+			return err
+		}
+
+		refs = append(refs, hash)
+	}
+
+	return writeCached(issueRefsFileKey(layout, rawDir, project, epicKey), refs, s.opts.Compression)
+}
+
+func objectFileKey(objectsDir, hash string) string {
+	return path.Join(objectsDir, hash[:2], hash+".json")
+}
+
+// writeObject stores the issue by the sha256 of its json, existing objects are not rewritten
+func (s *FSStore) writeObject(project string, issue jira.Issue) (string, error) {
+	b, err := json.Marshal(issue)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode issue: %s. %s", issue.Key, err)
+	}
+
+	sum := sha256.Sum256(b)
+	hash := hex.EncodeToString(sum[:])
+	fileKey := objectFileKey(s.objectsDir(project), hash)
+
+	for _, c := range compressions {
+		if _, err := os.Stat(fileKey + c.ext()); err == nil {
+			return hash, nil
+		}
+	}
+
+	err = util.WriteFileAtomic(fileKey+s.opts.Compression.ext(), func(w io.Writer) error {
+		cw, err := s.opts.Compression.writer(w)
+		if err != nil {
+			return err
+		}
+
+		if _, err := cw.Write(b); err != nil {
+			cw.Close()
+			return err
+		}
+
+		return cw.Close()
+	})
+
+	return hash, err
+}
+
+// readObject reads the issue object and checks its content against the hash
+func (s *FSStore) readObject(project, hash string) (jira.Issue, error) {
+	var issue jira.Issue
+
+	if len(hash) < 2 {
+		return issue, fmt.Errorf("invalid object hash: `%s`", hash)
+	}
+
+	fileKey := objectFileKey(s.objectsDir(project), hash)
+
+	for _, c := range compressions {
+		f, err := os.Open(fileKey + c.ext())
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return issue, err
+		}
+
+		b, err := readAllCompressed(f, c)
+		f.Close()
+		if err != nil {
+			return issue, fmt.Errorf("failed to read object: %s. %s", hash, err)
+		}
+
+		sum := sha256.Sum256(b)
+		if hex.EncodeToString(sum[:]) != hash {
+			return issue, fmt.Errorf("object checksum mismatch: %s", hash)
+		}
+
+		if err := json.NewDecoder(bytes.NewReader(b)).Decode(&issue); err != nil {
+			return issue, fmt.Errorf("failed to decode object: %s. %s", hash, err)
+		}
+
+		return issue, nil
+	}
+
+	return issue, fmt.Errorf("object not found: %s", hash)
+}
+
+func readAllCompressed(r io.Reader, c Compression) ([]byte, error) {
+	cr, err := c.reader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Close()
+
+	return io.ReadAll(cr)
+}
+
+// GC removes the project objects which are not referenced by any snapshot,
+// including the partial ones, and returns the number of removed objects
+func (s *FSStore) GC(project string) (int, error) {
+	projectDir := path.Join(s.baseDir, util.RemoveSpaces(project))
+
+	// both layouts: with and without the project dir inside raw_data
+	refFiles, err := filepath.Glob(path.Join(projectDir, "*", rawDataDir+"*", "*", "issues_*.refs.json*"))
+	if err != nil {
+		return 0, err
+	}
+
+	v2RefFiles, err := filepath.Glob(path.Join(projectDir, "*", rawDataDir+"*", "issues_*.refs.json*"))
+	if err != nil {
+		return 0, err
+	}
+
+	refFiles = append(refFiles, v2RefFiles...)
+
+	referenced := make(map[string]bool)
+	for _, refFile := range refFiles {
+		var refs []string
+		if _, err := readCachedFile(refFile, &refs); err != nil {
+			return 0, err
+		}
+
+		for _, hash := range refs {
+			referenced[hash] = true
+		}
+	}
+
+	objects, err := filepath.Glob(path.Join(s.objectsDir(project), "*", "*.json*"))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, object := range objects {
+		hash := strings.SplitN(path.Base(object), ".", 2)[0]
+		if referenced[hash] {
+			continue
+		}
+
+		if err := os.Remove(object); err != nil {
+			return removed, fmt.Errorf("failed to remove object: %s. %s", object, err)
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,457 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+
+	"github.com/makarski/roadsnap/util"
+)
+
+const (
+	rawDataDir = "raw_data"
+	// stagingSuffix marks a snapshot which is being fetched
+	stagingSuffix = ".partial"
+	// putSuffix marks a complete snapshot which is being stored,
+	// kept apart from the partial snapshot a cache run may resume
+	putSuffix = ".put"
+	// backupSuffix marks a replaced snapshot which is removed once the new one is in place
+	backupSuffix = ".old"
+)
+
+// FSStore keeps the snapshots in the work directory, see Layout:
+// <dir>/<Project>/<date>/raw_data/epics.json
+// <dir>/<Project>/<date>/raw_data/issues_<EpicKey>.json
+//
+// Deduplicated issues are stored as a list of object hashes, see FSOptions:
+// <dir>/<Project>/<date>/raw_data/issues_<EpicKey>.refs.json
+// <dir>/<Project>/objects/<hash[:2]>/<hash>.json
+//
+// Compressed files have an additional .gz or .zst extension.
+// All the layouts are read regardless of the options.
+type FSStore struct {
+	baseDir string
+	opts    FSOptions
+}
+
+// FSOptions controls how the snapshot files are written
+type FSOptions struct {
+	Compression Compression
+	// Dedup stores issues as content-addressed objects shared across the snapshot dates
+	Dedup bool
+}
+
+func NewFSStore(dir string) *FSStore {
+	return &FSStore{dir, FSOptions{Compression: CompressionNone}}
+}
+
+func (s *FSStore) SetOptions(opts FSOptions) {
+	if opts.Compression == "" {
+		opts.Compression = CompressionNone
+	}
+
+	s.opts = opts
+}
+
+func (s *FSStore) objectsDir(project string) string {
+	return path.Join(s.baseDir, util.RemoveSpaces(project), objectsDirName)
+}
+
+func (s *FSStore) rawDir(project string, date time.Time) string {
+	return path.Join(s.baseDir, util.RemoveSpaces(project), date.Format(DateFormat), rawDataDir)
+}
+
+// Put stores the snapshot through its own staging dir,
+// the partial snapshots of interrupted cache runs are kept
+func (s *FSStore) Put(snapshot *Snapshot) error {
+	rawDir := s.rawDir(snapshot.Project, snapshot.Date)
+	stagingDir := rawDir + putSuffix
+
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return fmt.Errorf("failed to remove staged snapshot: %s. %s", stagingDir, err)
+	}
+
+	if err := restoreBackup(rawDir + backupSuffix); err != nil {
+		return err
+	}
+
+	layout, err := s.writeLayout()
+	if err != nil {
+		return err
+	}
+
+	return putSnapshot(&fsSnapshotWriter{s, layout, snapshot.Project, stagingDir, rawDir}, snapshot)
+}
+
+func (s *FSStore) Get(project string, date time.Time) (*Snapshot, error) {
+	rawDir := s.rawDir(project, date)
+	layout := detectLayout(rawDir, project, CurrentLayout)
+	snapshot := &Snapshot{Project: project, Date: date, Issues: make(map[string][]jira.Issue)}
+
+	ok, err := readCached(epicFileKey(layout, rawDir, project), &snapshot.Epics)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("snapshot not found: %s %s", project, date.Format(DateFormat))
+	}
+
+	for _, epic := range snapshot.Epics {
+		issues, ok, err := s.readIssues(layout, rawDir, project, epic.Key)
+		if err == nil && !ok {
+			err = os.ErrNotExist
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cached issues for epic: %s. %s", epic.Key, err)
+		}
+
+		snapshot.Issues[epic.Key] = issues
+	}
+
+	manifest, ok, err := ReadManifest(rawDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		snapshot.Manifest = &manifest
+	}
+
+	return snapshot, nil
+}
+
+// Stage removes partial snapshots of other dates, restores interrupted commits
+// and, unless resume is enabled, discards the partial snapshot of the same date
+func (s *FSStore) Stage(project string, date time.Time, resume bool) (SnapshotWriter, error) {
+	rawDir := s.rawDir(project, date)
+	stagingDir := rawDir + stagingSuffix
+	projectDir := path.Join(s.baseDir, util.RemoveSpaces(project))
+
+	stale, err := filepath.Glob(path.Join(projectDir, "*", rawDataDir+stagingSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range stale {
+		if dir == stagingDir && resume {
+			continue
+		}
+
+		fmt.Printf("> removing partial snapshot: %s\n", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, fmt.Errorf("failed to remove partial snapshot: %s. %s", dir, err)
+		}
+
+		// the date dir is removed only if nothing else was stored there
+		os.Remove(path.Dir(dir))
+	}
+
+	backups, err := filepath.Glob(path.Join(projectDir, "*", rawDataDir+backupSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, backup := range backups {
+		if err := restoreBackup(backup); err != nil {
+			return nil, err
+		}
+	}
+
+	layout, err := s.writeLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	// a resumed partial snapshot keeps its layout
+	layout = detectLayout(stagingDir, project, layout)
+
+	return &fsSnapshotWriter{s, layout, project, stagingDir, rawDir}, nil
+}
+
+func (s *FSStore) ListProjects() ([]string, error) {
+	dirs, err := filepath.Glob(path.Join(s.baseDir, "*", "*", rawDataDir))
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, dir := range dirs {
+		project := path.Base(path.Dir(path.Dir(dir)))
+		if !seen[project] {
+			seen[project] = true
+			projects = append(projects, project)
+		}
+	}
+
+	sort.Strings(projects)
+
+	return projects, nil
+}
+
+func (s *FSStore) ListDates(project string) ([]string, error) {
+	dirs, err := filepath.Glob(path.Join(s.baseDir, util.RemoveSpaces(project), "*", rawDataDir))
+	if err != nil {
+		return nil, err
+	}
+
+	dates := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+
+		dates = append(dates, path.Base(path.Dir(dir)))
+	}
+
+	sort.Strings(dates)
+
+	return dates, nil
+}
+
+// Close is a no-op, FSStore holds no open files between the calls
+func (s *FSStore) Close() error {
+	return nil
+}
+
+func (s *FSStore) Delete(project string, date time.Time) error {
+	rawDir := s.rawDir(project, date)
+
+	if err := os.RemoveAll(rawDir); err != nil {
+		return fmt.Errorf("failed to delete snapshot: %s. %s", rawDir, err)
+	}
+
+	// the date dir is removed only if no reports were stored there
+	os.Remove(path.Dir(rawDir))
+
+	return nil
+}
+
+type fsSnapshotWriter struct {
+	store      *FSStore
+	layout     Layout
+	project    string
+	stagingDir string
+	rawDir     string
+}
+
+func (w *fsSnapshotWriter) Epics() ([]jira.Issue, bool, error) {
+	var epics []jira.Issue
+	ok, err := readCached(epicFileKey(w.layout, w.stagingDir, w.project), &epics)
+
+	return epics, ok, err
+}
+
+func (w *fsSnapshotWriter) Issues(epicKey string) ([]jira.Issue, bool, error) {
+	return w.store.readIssues(w.layout, w.stagingDir, w.project, epicKey)
+}
+
+func (w *fsSnapshotWriter) PutEpics(epics []jira.Issue) error {
+	return writeCached(epicFileKey(w.layout, w.stagingDir, w.project), epics, w.store.opts.Compression)
+}
+
+func (w *fsSnapshotWriter) PutIssues(epicKey string, issues []jira.Issue) error {
+	return w.store.writeIssues(w.layout, w.stagingDir, w.project, epicKey, issues)
+}
+
+// Commit writes the manifest and moves the staging directory into place.
+// An existing snapshot of the same date is replaced.
+func (w *fsSnapshotWriter) Commit(manifest Manifest) error {
+	// a snapshot with no epics has no files staged yet
+	if err := os.MkdirAll(w.stagingDir, os.FileMode(0744)); err != nil {
+		return err
+	}
+
+	if err := writeManifest(w.stagingDir, manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %s", err)
+	}
+
+	backup := w.rawDir + backupSuffix
+
+	if err := os.RemoveAll(backup); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(w.rawDir); err == nil {
+		if err := os.Rename(w.rawDir, backup); err != nil {
+			return err
+		}
+	}
+
+	// the staging dir is kept on failure, a cache run of the same date resumes a partial snapshot
+	if err := os.Rename(w.stagingDir, w.rawDir); err != nil {
+		err = fmt.Errorf("failed to commit snapshot: %s. %s", w.rawDir, err)
+		if rErr := restoreBackup(backup); rErr != nil {
+			return fmt.Errorf("%s. failed to restore the replaced snapshot: %s", err, rErr)
+		}
+		return err
+	}
+
+	return os.RemoveAll(backup)
+}
+
+// restoreBackup puts back a snapshot replaced by an interrupted commit
+// or removes the backup if the commit went through
+func restoreBackup(backup string) error {
+	rawDir := strings.TrimSuffix(backup, backupSuffix)
+
+	if _, err := os.Stat(backup); os.IsNotExist(err) {
+		return nil
+	}
+
+	if _, err := os.Stat(rawDir); os.IsNotExist(err) {
+		fmt.Printf("> restoring snapshot: %s\n", rawDir)
+		return os.Rename(backup, rawDir)
+	}
+
+	return os.RemoveAll(backup)
+}
+
+// readCached decodes a cached file of any compression, returns false if the file does not exist
+func readCached(fileKey string, v interface{}) (bool, error) {
+	for _, c := range compressions {
+		ok, err := readCachedFile(fileKey+c.ext(), v)
+		if ok || err != nil {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+func readCachedFile(fileKey string, v interface{}) (bool, error) {
+	f, err := os.Open(fileKey)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	defer f.Close()
+
+	r, err := compressionByFileKey(fileKey).reader(f)
+	if err != nil {
+		return false, fmt.Errorf("failed to decompress cached file: %s. %s", fileKey, err)
+	}
+	defer r.Close()
+
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return false, fmt.Errorf("failed to decode cached file: %s. %s", fileKey, err)
+	}
+
+	return true, nil
+}
+
+func writeCached(fileKey string, v interface{}, c Compression) error {
+	return util.WriteFileAtomic(fileKey+c.ext(), func(w io.Writer) error {
+		cw, err := c.writer(w)
+		if err != nil {
+			return err
+		}
+
+		if err := json.NewEncoder(cw).Encode(v); err != nil {
+			cw.Close()
+			return err
+		}
+
+		return cw.Close()
+	})
+}
+
+// writeManifest checksums the snapshot files and writes the manifest to the raw data dir
+func writeManifest(rawDir string, manifest Manifest) error {
+	files, err := checksumFiles(rawDir)
+	if err != nil {
+		return err
+	}
+
+	manifest.Files = files
+
+	return writeManifestFile(rawDir, manifest)
+}
+
+func writeManifestFile(rawDir string, manifest Manifest) error {
+	return util.WriteFileAtomic(path.Join(rawDir, ManifestFileName), func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(manifest)
+	})
+}
+
+// ReadManifest returns the manifest of the snapshot, false if the snapshot has none
+func ReadManifest(rawDir string) (Manifest, bool, error) {
+	var manifest Manifest
+	ok, err := readCached(path.Join(rawDir, ManifestFileName), &manifest)
+
+	return manifest, ok, err
+}
+
+// checksumFiles returns sha256 checksums of all the files in the raw data dir except the manifest
+func checksumFiles(rawDir string) (map[string]string, error) {
+	files := make(map[string]string)
+
+	err := fs.WalkDir(os.DirFS(rawDir), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || p == ManifestFileName || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+
+		sum, err := checksumFile(path.Join(rawDir, p))
+		if err != nil {
+			return err
+		}
+
+		files[p] = sum
+		return nil
+	})
+
+	return files, err
+}
+
+// Verify checks the snapshot files against the snapshot manifest
+func (s *FSStore) Verify(project string, date time.Time) (VerifyResult, error) {
+	rawDir := s.rawDir(project, date)
+	result := VerifyResult{Project: project, Date: date.Format(DateFormat), Problems: make([]string, 0)}
+
+	manifest, ok, err := ReadManifest(rawDir)
+	if err != nil || !ok {
+		return result, err
+	}
+
+	result.HasManifest = true
+
+	actual, err := checksumFiles(rawDir)
+	if err != nil {
+		return result, err
+	}
+
+	result.checkFiles(manifest.Files, actual)
+
+	snapshot, err := s.Get(project, date)
+	if err != nil {
+		result.Problems = append(result.Problems, fmt.Sprintf("failed to read snapshot: %s", err))
+		return result, nil
+	}
+
+	result.checkCounts(manifest, snapshot)
+
+	return result, nil
+}
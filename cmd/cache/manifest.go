@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/makarski/roadsnap/config"
+)
+
+const (
+	ManifestFileName = "manifest.json"
+	manifestVersion  = 1
+)
+
+// ToolVersion is recorded in the snapshot manifests, set at build time:
+// -ldflags "-X github.com/makarski/roadsnap/cmd/cache.ToolVersion=v1.0.0"
+var ToolVersion = "dev"
+
+// Manifest describes a complete snapshot
+type Manifest struct {
+	ManifestVersion int                 `json:"manifest_version"`
+	ToolVersion     string              `json:"tool_version"`
+	Project         string              `json:"project"`
+	SnapshotDate    string              `json:"snapshot_date"`
+	FetchedAt       time.Time           `json:"fetched_at"`
+	EpicsJQL        string              `json:"epics_jql"`
+	IssuesJQL       string              `json:"issues_jql"`
+	StatusNames     *config.StatusNames `json:"status_names,omitempty"`
+	EpicCount       int                 `json:"epic_count"`
+	IssueCount      int                 `json:"issue_count"`
+	// Files maps the file path relative to the raw_data dir to its sha256 checksum,
+	// SQLiteStore maps the epics and the issues of each epic, see: checksumRows
+	Files map[string]string `json:"files"`
+	// Changelog is true if the issues are cached with their changelogs
+	Changelog bool `json:"changelog,omitempty"`
+}
+
+func (ec *EpicCacher) newManifest(date time.Time, project config.Project, epicCount, issueCount int) Manifest {
+	return Manifest{
+		ManifestVersion: manifestVersion,
+		ToolVersion:     ToolVersion,
+		Project:         project.Name,
+		SnapshotDate:    date.Format(DateFormat),
+		FetchedAt:       time.Now().UTC(),
+		EpicsJQL:        ec.rv.EpicsJQL(project),
+		IssuesJQL:       ec.rv.IssuesJQL(project),
+		StatusNames:     ec.opts.StatusNames,
+		Changelog:       ec.rv.Changelog(),
+		EpicCount:       epicCount,
+		IssueCount:      issueCount,
+	}
+}
+
+func checksumFile(fileKey string) (string, error) {
+	f, err := os.Open(fileKey)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to checksum file: %s. %s", fileKey, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyResult lists the problems found in a snapshot
+type VerifyResult struct {
+	Project     string
+	Date        string
+	HasManifest bool
+	Problems    []string
+}
+
+func (vr VerifyResult) OK() bool {
+	return vr.HasManifest && len(vr.Problems) == 0
+}
+
+func (vr *VerifyResult) checkFiles(expected, actual map[string]string) {
+	files := make([]string, 0, len(expected))
+	for file := range expected {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		sum, ok := actual[file]
+		switch {
+		case !ok:
+			vr.Problems = append(vr.Problems, fmt.Sprintf("missing file: %s", file))
+		case sum != expected[file]:
+			vr.Problems = append(vr.Problems, fmt.Sprintf("checksum mismatch: %s", file))
+		}
+	}
+
+	unexpected := make([]string, 0)
+	for file := range actual {
+		if _, ok := expected[file]; !ok {
+			unexpected = append(unexpected, file)
+		}
+	}
+	sort.Strings(unexpected)
+
+	for _, file := range unexpected {
+		vr.Problems = append(vr.Problems, fmt.Sprintf("unexpected file: %s", file))
+	}
+}
+
+func (vr *VerifyResult) checkCounts(manifest Manifest, snapshot *Snapshot) {
+	issueCount := 0
+	for _, issues := range snapshot.Issues {
+		issueCount += len(issues)
+	}
+
+	if len(snapshot.Epics) != manifest.EpicCount {
+		vr.Problems = append(vr.Problems, fmt.Sprintf("epic count: expected %d, found %d", manifest.EpicCount, len(snapshot.Epics)))
+	}
+
+	if issueCount != manifest.IssueCount {
+		vr.Problems = append(vr.Problems, fmt.Sprintf("issue count: expected %d, found %d", manifest.IssueCount, issueCount))
+	}
+}
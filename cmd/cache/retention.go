@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/makarski/roadsnap/config"
+)
+
+// RetentionPolicy defines which snapshots are kept by age.
+// All snapshots younger than DailyDays are kept, then the oldest snapshot of each week
+// up to WeeklyWeeks and the oldest snapshot of each month up to MonthlyMonths.
+// Zero MonthlyMonths keeps monthly snapshots forever.
+type RetentionPolicy struct {
+	DailyDays     int
+	WeeklyWeeks   int
+	MonthlyMonths int
+}
+
+const (
+	defaultRetentionDailyDays   = 30
+	defaultRetentionWeeklyWeeks = 26
+)
+
+// NewRetentionPolicy returns the retention policy from the config, falling back to defaults
+func NewRetentionPolicy(cfg *config.Retention) RetentionPolicy {
+	policy := RetentionPolicy{
+		DailyDays:   defaultRetentionDailyDays,
+		WeeklyWeeks: defaultRetentionWeeklyWeeks,
+	}
+
+	if cfg == nil {
+		return policy
+	}
+
+	if cfg.DailyDays > 0 {
+		policy.DailyDays = cfg.DailyDays
+	}
+
+	if cfg.WeeklyWeeks > 0 {
+		policy.WeeklyWeeks = cfg.WeeklyWeeks
+	}
+
+	policy.MonthlyMonths = cfg.MonthlyMonths
+
+	return policy
+}
+
+// Select splits the snapshot dates into the ones to keep and the ones to remove.
+// The most recent snapshot is always kept.
+func (rp RetentionPolicy) Select(dates []string, now time.Time) ([]string, []string, error) {
+	sorted := append([]string{}, dates...)
+	sort.Strings(sorted)
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	dailyFrom := today.AddDate(0, 0, -rp.DailyDays)
+	weeklyFrom := today.AddDate(0, 0, -7*rp.WeeklyWeeks)
+	monthlyFrom := today.AddDate(0, -rp.MonthlyMonths, 0)
+
+	keep, remove := make([]string, 0), make([]string, 0)
+	weeks, months := make(map[string]bool), make(map[string]bool)
+
+	for i, date := range sorted {
+		t, err := time.Parse(DateFormat, date)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse snapshot date: %s. %s", date, err)
+		}
+
+		year, week := t.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%d", year, week)
+		monthKey := t.Format("2006-01")
+
+		// ascending order: the first snapshot of a bucket is the oldest one
+		firstOfWeek, firstOfMonth := !weeks[weekKey], !months[monthKey]
+		weeks[weekKey], months[monthKey] = true, true
+
+		switch {
+		case i == len(sorted)-1,
+			!t.Before(dailyFrom),
+			firstOfWeek && !t.Before(weeklyFrom),
+			firstOfMonth && (rp.MonthlyMonths == 0 || !t.Before(monthlyFrom)):
+			keep = append(keep, date)
+		default:
+			remove = append(remove, date)
+		}
+	}
+
+	return keep, remove, nil
+}
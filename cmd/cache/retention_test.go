@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicySelect(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		now    string
+		dates  []string
+		keep   []string
+		remove []string
+	}{
+		{
+			name:   "latest snapshot is always kept",
+			policy: RetentionPolicy{DailyDays: 1, WeeklyWeeks: 1, MonthlyMonths: 1},
+			now:    "2026-10-17",
+			dates:  []string{"2020-01-15"},
+			keep:   []string{"2020-01-15"},
+			remove: []string{},
+		},
+		{
+			name:   "daily window keeps every recent snapshot",
+			policy: RetentionPolicy{DailyDays: 7, WeeklyWeeks: 1, MonthlyMonths: 1},
+			now:    "2026-10-17",
+			dates:  []string{"2026-10-12", "2026-10-10", "2026-10-11", "2026-10-09", "2026-10-01"},
+			keep:   []string{"2026-10-01", "2026-10-10", "2026-10-11", "2026-10-12"},
+			remove: []string{"2026-10-09"},
+		},
+		{
+			name:   "weekly buckets follow iso weeks across the year end",
+			policy: RetentionPolicy{DailyDays: 0, WeeklyWeeks: 4, MonthlyMonths: 0},
+			now:    "2027-01-10",
+			dates: []string{
+				"2026-12-28", "2026-12-31", "2027-01-01", "2027-01-02",
+				"2027-01-04", "2027-01-05", "2027-01-10",
+			},
+			keep:   []string{"2026-12-28", "2027-01-01", "2027-01-04", "2027-01-10"},
+			remove: []string{"2026-12-31", "2027-01-02", "2027-01-05"},
+		},
+		{
+			name:   "monthly buckets keep the oldest snapshot within the months",
+			policy: RetentionPolicy{DailyDays: 0, WeeklyWeeks: 1, MonthlyMonths: 2},
+			now:    "2026-10-17",
+			dates: []string{
+				"2026-07-31", "2026-08-03", "2026-09-02", "2026-09-09",
+				"2026-10-12", "2026-10-13", "2026-10-17",
+			},
+			keep:   []string{"2026-09-02", "2026-10-12", "2026-10-17"},
+			remove: []string{"2026-07-31", "2026-08-03", "2026-09-09", "2026-10-13"},
+		},
+		{
+			name:   "zero monthly months keeps monthly snapshots forever",
+			policy: RetentionPolicy{DailyDays: 0, WeeklyWeeks: 1, MonthlyMonths: 0},
+			now:    "2026-10-17",
+			dates: []string{
+				"2024-02-20", "2024-02-21", "2026-07-31", "2026-08-03", "2026-10-17",
+			},
+			keep:   []string{"2024-02-20", "2026-07-31", "2026-08-03", "2026-10-17"},
+			remove: []string{"2024-02-21"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(DateFormat, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			keep, remove, err := tt.policy.Select(tt.dates, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(keep, tt.keep) {
+				t.Errorf("keep = %v, want %v", keep, tt.keep)
+			}
+
+			if !reflect.DeepEqual(remove, tt.remove) {
+				t.Errorf("remove = %v, want %v", remove, tt.remove)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicySelectInvalidDate(t *testing.T) {
+	policy := RetentionPolicy{DailyDays: 1}
+
+	if _, _, err := policy.Select([]string{"2026-10-17", "latest"}, time.Now()); err == nil {
+		t.Error("expected an error for an invalid snapshot date")
+	}
+}
@@ -0,0 +1,610 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/makarski/roadsnap/util"
+	// registers the sqlite3 database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS snapshots (
+	id            INTEGER PRIMARY KEY,
+	project       TEXT    NOT NULL,
+	snapshot_date TEXT    NOT NULL,
+	committed     INTEGER NOT NULL DEFAULT 0,
+	fetched_at    TEXT,
+	manifest      TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS snapshots_committed ON snapshots (project, snapshot_date) WHERE committed = 1;
+CREATE UNIQUE INDEX IF NOT EXISTS snapshots_staged ON snapshots (project, snapshot_date) WHERE committed = 0;
+
+CREATE TABLE IF NOT EXISTS epics (
+	snapshot_id    INTEGER NOT NULL REFERENCES snapshots (id) ON DELETE CASCADE,
+	position       INTEGER NOT NULL,
+	key            TEXT    NOT NULL,
+	summary        TEXT,
+	status         TEXT,
+	start_date     TEXT,
+	due_date       TEXT,
+	issues_fetched INTEGER NOT NULL DEFAULT 0,
+	raw            TEXT    NOT NULL,
+	PRIMARY KEY (snapshot_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS epics_key ON epics (key);
+
+CREATE TABLE IF NOT EXISTS issues (
+	snapshot_id INTEGER NOT NULL REFERENCES snapshots (id) ON DELETE CASCADE,
+	epic_key    TEXT    NOT NULL,
+	position    INTEGER NOT NULL,
+	key         TEXT    NOT NULL,
+	summary     TEXT,
+	status      TEXT,
+	raw         TEXT    NOT NULL,
+	PRIMARY KEY (snapshot_id, epic_key, key)
+);
+`
+
+// SQLiteStore keeps the snapshots in a single sqlite database file
+// normalized into snapshots, epics and issues tables.
+// Projects are keyed by the name without spaces, same as the directories of FSStore.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", dbPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite store: %s. %s", dbPath, err)
+	}
+
+	// the writes are serialized by sqlite, a single connection avoids lock errors
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create sqlite schema: %s. %s", dbPath, err)
+	}
+
+	return &SQLiteStore{db}, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Put replaces the snapshot of the same date in a single transaction,
+// the staged snapshots of interrupted cache runs are kept
+func (s *SQLiteStore) Put(snapshot *Snapshot) error {
+	issueCount := 0
+	for _, epic := range snapshot.Epics {
+		issueCount += len(snapshot.Issues[epic.Key])
+	}
+
+	manifest := snapshotManifest(snapshot, issueCount)
+	project, snapshotDate := util.RemoveSpaces(snapshot.Project), snapshot.Date.Format(DateFormat)
+
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`DELETE FROM snapshots WHERE project = ? AND snapshot_date = ? AND committed = 1`,
+			project, snapshotDate,
+		)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(
+			`INSERT INTO snapshots (project, snapshot_date, committed) VALUES (?, ?, 1)`,
+			project, snapshotDate,
+		)
+		if err != nil {
+			return err
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		if err := putEpics(tx, id, snapshot.Epics); err != nil {
+			return err
+		}
+
+		for _, epic := range snapshot.Epics {
+			if err := putIssues(tx, id, epic.Key, snapshot.Issues[epic.Key]); err != nil {
+				return err
+			}
+		}
+
+		return commitManifest(tx, id, manifest)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store snapshot: %s, %s. %s", snapshot.Project, snapshotDate, err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) Get(project string, date time.Time) (*Snapshot, error) {
+	var (
+		id          int64
+		rawManifest sql.NullString
+	)
+
+	err := s.db.QueryRow(
+		`SELECT id, manifest FROM snapshots WHERE project = ? AND snapshot_date = ? AND committed = 1`,
+		util.RemoveSpaces(project), date.Format(DateFormat),
+	).Scan(&id, &rawManifest)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("snapshot not found: %s %s", project, date.Format(DateFormat))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{Project: project, Date: date, Issues: make(map[string][]jira.Issue)}
+
+	if rawManifest.Valid {
+		var manifest Manifest
+		if err := json.Unmarshal([]byte(rawManifest.String), &manifest); err != nil {
+			return nil, fmt.Errorf("failed to decode manifest: %s", err)
+		}
+		snapshot.Manifest = &manifest
+	}
+
+	if snapshot.Epics, err = s.queryIssues(`SELECT raw FROM epics WHERE snapshot_id = ? ORDER BY position`, id); err != nil {
+		return nil, err
+	}
+
+	for _, epic := range snapshot.Epics {
+		issues, err := s.queryIssues(`SELECT raw FROM issues WHERE snapshot_id = ? AND epic_key = ? ORDER BY position`, id, epic.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cached issues for epic: %s. %s", epic.Key, err)
+		}
+
+		snapshot.Issues[epic.Key] = issues
+	}
+
+	return snapshot, nil
+}
+
+func (s *SQLiteStore) queryIssues(query string, args ...interface{}) ([]jira.Issue, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	issues := make([]jira.Issue, 0)
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+
+		var issue jira.Issue
+		if err := json.Unmarshal([]byte(raw), &issue); err != nil {
+			return nil, fmt.Errorf("failed to decode issue: %s", err)
+		}
+
+		issues = append(issues, issue)
+	}
+
+	return issues, rows.Err()
+}
+
+// Stage removes staged snapshots of other dates and, unless resume is enabled,
+// discards the staged snapshot of the same date
+func (s *SQLiteStore) Stage(project string, date time.Time, resume bool) (SnapshotWriter, error) {
+	snapshotDate := date.Format(DateFormat)
+
+	query := `DELETE FROM snapshots WHERE project = ? AND committed = 0 AND snapshot_date != ?`
+	args := []interface{}{util.RemoveSpaces(project), snapshotDate}
+	if !resume {
+		query = `DELETE FROM snapshots WHERE project = ? AND committed = 0`
+		args = args[:1]
+	}
+
+	if _, err := s.db.Exec(query, args...); err != nil {
+		return nil, fmt.Errorf("failed to remove staged snapshots: %s. %s", project, err)
+	}
+
+	_, err := s.db.Exec(
+		`INSERT INTO snapshots (project, snapshot_date, committed) VALUES (?, ?, 0) ON CONFLICT DO NOTHING`,
+		util.RemoveSpaces(project), snapshotDate,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage snapshot: %s. %s", project, err)
+	}
+
+	var id int64
+	err = s.db.QueryRow(
+		`SELECT id FROM snapshots WHERE project = ? AND snapshot_date = ? AND committed = 0`,
+		util.RemoveSpaces(project), snapshotDate,
+	).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage snapshot: %s. %s", project, err)
+	}
+
+	return &sqliteSnapshotWriter{s.db, id, util.RemoveSpaces(project), snapshotDate}, nil
+}
+
+func (s *SQLiteStore) ListProjects() ([]string, error) {
+	return s.queryStrings(`SELECT DISTINCT project FROM snapshots WHERE committed = 1 ORDER BY project`)
+}
+
+func (s *SQLiteStore) ListDates(project string) ([]string, error) {
+	return s.queryStrings(
+		`SELECT snapshot_date FROM snapshots WHERE project = ? AND committed = 1 ORDER BY snapshot_date`,
+		util.RemoveSpaces(project),
+	)
+}
+
+func (s *SQLiteStore) queryStrings(query string, args ...interface{}) ([]string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]string, 0)
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
+
+func (s *SQLiteStore) Delete(project string, date time.Time) error {
+	_, err := s.db.Exec(
+		`DELETE FROM snapshots WHERE project = ? AND snapshot_date = ? AND committed = 1`,
+		util.RemoveSpaces(project), date.Format(DateFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete snapshot: %s %s. %s", project, date.Format(DateFormat), err)
+	}
+
+	return nil
+}
+
+// EpicDueDates returns the epic due dates observed in every snapshot of the project
+// ordered by the snapshot date
+func (s *SQLiteStore) EpicDueDates(project string) ([]EpicDueDate, error) {
+	rows, err := s.db.Query(`
+		SELECT e.key, s.snapshot_date, COALESCE(e.due_date, '')
+		FROM epics e JOIN snapshots s ON s.id = e.snapshot_id
+		WHERE s.project = ? AND s.committed = 1
+		ORDER BY s.snapshot_date, e.position`,
+		util.RemoveSpaces(project),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dueDates := make([]EpicDueDate, 0)
+	for rows.Next() {
+		var key, snapshotDate, dueDate string
+		if err := rows.Scan(&key, &snapshotDate, &dueDate); err != nil {
+			return nil, err
+		}
+
+		item := EpicDueDate{Key: key}
+
+		if item.SnapshotDate, err = time.Parse(DateFormat, snapshotDate); err != nil {
+			return nil, err
+		}
+
+		if dueDate != "" {
+			if item.DueDate, err = time.Parse(DateFormat, dueDate); err != nil {
+				return nil, err
+			}
+		}
+
+		dueDates = append(dueDates, item)
+	}
+
+	return dueDates, rows.Err()
+}
+
+// Verify checks the stored rows against the snapshot manifest
+func (s *SQLiteStore) Verify(project string, date time.Time) (VerifyResult, error) {
+	result := VerifyResult{Project: project, Date: date.Format(DateFormat), Problems: make([]string, 0)}
+
+	var (
+		id          int64
+		rawManifest sql.NullString
+	)
+
+	err := s.db.QueryRow(
+		`SELECT id, manifest FROM snapshots WHERE project = ? AND snapshot_date = ? AND committed = 1`,
+		util.RemoveSpaces(project), date.Format(DateFormat),
+	).Scan(&id, &rawManifest)
+	if err != nil || !rawManifest.Valid {
+		return result, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal([]byte(rawManifest.String), &manifest); err != nil {
+		return result, fmt.Errorf("failed to decode manifest: %s", err)
+	}
+
+	result.HasManifest = true
+
+	actual, err := checksumRows(s.db, id)
+	if err != nil {
+		return result, err
+	}
+
+	result.checkFiles(manifest.Files, actual)
+
+	snapshot, err := s.Get(project, date)
+	if err != nil {
+		result.Problems = append(result.Problems, fmt.Sprintf("failed to read snapshot: %s", err))
+		return result, nil
+	}
+
+	result.checkCounts(manifest, snapshot)
+
+	return result, nil
+}
+
+type sqliteSnapshotWriter struct {
+	db           *sql.DB
+	id           int64
+	project      string
+	snapshotDate string
+}
+
+func (w *sqliteSnapshotWriter) Epics() ([]jira.Issue, bool, error) {
+	epics, err := (&SQLiteStore{w.db}).queryIssues(`SELECT raw FROM epics WHERE snapshot_id = ? ORDER BY position`, w.id)
+
+	return epics, err == nil && len(epics) > 0, err
+}
+
+func (w *sqliteSnapshotWriter) Issues(epicKey string) ([]jira.Issue, bool, error) {
+	var fetched bool
+	err := w.db.QueryRow(
+		`SELECT issues_fetched FROM epics WHERE snapshot_id = ? AND key = ?`, w.id, epicKey,
+	).Scan(&fetched)
+
+	if err == sql.ErrNoRows || (err == nil && !fetched) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	issues, err := (&SQLiteStore{w.db}).queryIssues(
+		`SELECT raw FROM issues WHERE snapshot_id = ? AND epic_key = ? ORDER BY position`, w.id, epicKey,
+	)
+
+	return issues, err == nil, err
+}
+
+func (w *sqliteSnapshotWriter) PutEpics(epics []jira.Issue) error {
+	return w.inTx(func(tx *sql.Tx) error {
+		return putEpics(tx, w.id, epics)
+	})
+}
+
+func (w *sqliteSnapshotWriter) PutIssues(epicKey string, issues []jira.Issue) error {
+	return w.inTx(func(tx *sql.Tx) error {
+		return putIssues(tx, w.id, epicKey, issues)
+	})
+}
+
+func putEpics(tx *sql.Tx, snapshotID int64, epics []jira.Issue) error {
+	if _, err := tx.Exec(`DELETE FROM epics WHERE snapshot_id = ?`, snapshotID); err != nil {
+		return err
+	}
+
+	for i, epic := range epics {
+		raw, err := json.Marshal(epic)
+		if err != nil {
+			return err
+		}
+
+		link, err := NewEpicLink(epic)
+		if err != nil {
+			return fmt.Errorf("failed to read epic: %s. %s", epic.Key, err)
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO epics (snapshot_id, position, key, summary, status, start_date, due_date, raw)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			snapshotID, i, epic.Key, issueSummary(epic), issueStatus(epic),
+			nullDate(link.StartDate), nullDate(link.DueDate), string(raw),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store epic: %s. %s", epic.Key, err)
+		}
+	}
+
+	return nil
+}
+
+func putIssues(tx *sql.Tx, snapshotID int64, epicKey string, issues []jira.Issue) error {
+	if _, err := tx.Exec(`DELETE FROM issues WHERE snapshot_id = ? AND epic_key = ?`, snapshotID, epicKey); err != nil {
+		return err
+	}
+
+	for i, issue := range issues {
+		raw, err := json.Marshal(issue)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO issues (snapshot_id, epic_key, position, key, summary, status, raw)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			snapshotID, epicKey, i, issue.Key, issueSummary(issue), issueStatus(issue), string(raw),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store issue: %s. %s", issue.Key, err)
+		}
+	}
+
+	_, err := tx.Exec(`UPDATE epics SET issues_fetched = 1 WHERE snapshot_id = ? AND key = ?`, snapshotID, epicKey)
+	return err
+}
+
+// Commit replaces a committed snapshot of the same date with the staged one
+func (w *sqliteSnapshotWriter) Commit(manifest Manifest) error {
+	return w.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`DELETE FROM snapshots WHERE project = ? AND snapshot_date = ? AND committed = 1`,
+			w.project, w.snapshotDate,
+		)
+		if err != nil {
+			return err
+		}
+
+		return commitManifest(tx, w.id, manifest)
+	})
+}
+
+// commitManifest marks the snapshot committed with the manifest of its stored rows
+func commitManifest(tx *sql.Tx, snapshotID int64, manifest Manifest) error {
+	files, err := checksumRows(tx, snapshotID)
+	if err != nil {
+		return err
+	}
+	manifest.Files = files
+
+	rawManifest, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE snapshots SET committed = 1, fetched_at = ?, manifest = ? WHERE id = ?`,
+		manifest.FetchedAt.Format(time.RFC3339), string(rawManifest), snapshotID,
+	)
+	return err
+}
+
+type sqlQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// checksumRows returns sha256 checksums of the raw epics and the raw issues of each epic,
+// keyed as the FSStore files without the extension: epics, issues_<EpicKey>
+func checksumRows(q sqlQueryer, snapshotID int64) (map[string]string, error) {
+	hashes := make(map[string]hash.Hash)
+	write := func(name, raw string) {
+		h, ok := hashes[name]
+		if !ok {
+			h = sha256.New()
+			hashes[name] = h
+		}
+		io.WriteString(h, raw+"\n")
+	}
+
+	epics, err := q.Query(`SELECT key, raw FROM epics WHERE snapshot_id = ? ORDER BY position`, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer epics.Close()
+
+	for epics.Next() {
+		var key, raw string
+		if err := epics.Scan(&key, &raw); err != nil {
+			return nil, err
+		}
+
+		write("epics", raw)
+		write("issues_"+key, "")
+	}
+
+	if err := epics.Err(); err != nil {
+		return nil, err
+	}
+
+	issues, err := q.Query(`SELECT epic_key, raw FROM issues WHERE snapshot_id = ? ORDER BY epic_key, position`, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer issues.Close()
+
+	for issues.Next() {
+		var epicKey, raw string
+		if err := issues.Scan(&epicKey, &raw); err != nil {
+			return nil, err
+		}
+
+		write("issues_"+epicKey, raw)
+	}
+
+	if err := issues.Err(); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string, len(hashes))
+	for name, h := range hashes {
+		files[name] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return files, nil
+}
+
+func (w *sqliteSnapshotWriter) inTx(f func(*sql.Tx) error) error {
+	return inTx(w.db, f)
+}
+
+func inTx(db *sql.DB, f func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func nullDate(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t.Format(DateFormat)
+}
+
+func issueSummary(issue jira.Issue) string {
+	if issue.Fields == nil {
+		return ""
+	}
+
+	return issue.Fields.Summary
+}
+
+func issueStatus(issue jira.Issue) string {
+	if issue.Fields == nil || issue.Fields.Status == nil {
+		return ""
+	}
+
+	return issue.Fields.Status.Name
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"io"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+type (
+	// Store persists project snapshots.
+	// The snapshots are addressed by the project name and the snapshot date.
+	Store interface {
+		// Put stores a complete snapshot, replacing an existing one of the same date
+		Put(snapshot *Snapshot) error
+		// Get returns a stored snapshot
+		Get(project string, date time.Time) (*Snapshot, error)
+		// Stage starts a new snapshot which is stored only once committed.
+		// If resume is set, data staged by an interrupted run of the same date is kept.
+		Stage(project string, date time.Time, resume bool) (SnapshotWriter, error)
+		// ListProjects returns the names of projects with stored snapshots
+		ListProjects() ([]string, error)
+		// ListDates returns the project snapshot dates in ascending order
+		ListDates(project string) ([]string, error)
+		// Delete removes a stored snapshot
+		Delete(project string, date time.Time) error
+		// Close releases the resources held by the store
+		io.Closer
+	}
+
+	// SnapshotWriter accumulates a snapshot until it is committed
+	SnapshotWriter interface {
+		// Epics returns the staged epics, false if nothing was staged
+		Epics() ([]jira.Issue, bool, error)
+		// Issues returns the staged epic issues, false if nothing was staged
+		Issues(epicKey string) ([]jira.Issue, bool, error)
+		PutEpics(epics []jira.Issue) error
+		PutIssues(epicKey string, issues []jira.Issue) error
+		// Commit stores the staged snapshot along with its manifest
+		Commit(manifest Manifest) error
+	}
+
+	// Verifier is implemented by the stores which can check the snapshot integrity
+	Verifier interface {
+		Verify(project string, date time.Time) (VerifyResult, error)
+	}
+
+	// HistoryStore is implemented by the stores which can query the epic history
+	// without reading every snapshot
+	HistoryStore interface {
+		EpicDueDates(project string) ([]EpicDueDate, error)
+	}
+
+	// EpicDueDate is the epic due date observed in a snapshot
+	EpicDueDate struct {
+		Key          string
+		SnapshotDate time.Time
+		DueDate      time.Time
+	}
+
+	// Snapshot is the raw jira data of a project at a date
+	Snapshot struct {
+		Project string
+		Date    time.Time
+		// Manifest is nil for the snapshots taken before manifests were introduced
+		Manifest *Manifest
+		Epics    []jira.Issue
+		// Issues are the epic issues by the epic key
+		Issues map[string][]jira.Issue
+	}
+)
+
+// putSnapshot stores a complete snapshot through a snapshot writer
+func putSnapshot(w SnapshotWriter, snapshot *Snapshot) error {
+	if err := w.PutEpics(snapshot.Epics); err != nil {
+		return err
+	}
+
+	issueCount := 0
+	for _, epic := range snapshot.Epics {
+		issues := snapshot.Issues[epic.Key]
+		issueCount += len(issues)
+
+		if err := w.PutIssues(epic.Key, issues); err != nil {
+			return err
+		}
+	}
+
+	return w.Commit(snapshotManifest(snapshot, issueCount))
+}
+
+// snapshotManifest returns the snapshot manifest, a new one for the snapshots taken without it
+func snapshotManifest(snapshot *Snapshot, issueCount int) Manifest {
+	if snapshot.Manifest != nil {
+		return *snapshot.Manifest
+	}
+
+	return Manifest{
+		ManifestVersion: manifestVersion,
+		ToolVersion:     ToolVersion,
+		Project:         snapshot.Project,
+		SnapshotDate:    snapshot.Date.Format(DateFormat),
+		FetchedAt:       time.Now().UTC(),
+		EpicCount:       len(snapshot.Epics),
+		IssueCount:      issueCount,
+	}
+}
@@ -0,0 +1,264 @@
+package chart
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/util"
+)
+
+// ChartType is the chart drawn by the chart command
+type ChartType string
+
+const (
+	TypeStacked  ChartType = "stacked"
+	TypeBurnUp   ChartType = "burnup"
+	TypeBurnDown ChartType = "burndown"
+)
+
+func ParseChartType(s string) (ChartType, error) {
+	switch t := ChartType(s); t {
+	case TypeStacked, TypeBurnUp, TypeBurnDown:
+		return t, nil
+	}
+
+	return "", fmt.Errorf("unsupported chart type: `%s`. expected one of: %s, %s, %s", s, TypeStacked, TypeBurnUp, TypeBurnDown)
+}
+
+type (
+	// Burn is the scope and the completed work of the project or of an epic over the snapshots
+	Burn struct {
+		Points []BurnPoint
+		// Weighted is set if all the snapshots are estimated, the points are compared by the story counts otherwise
+		Weighted bool
+		Unit     string
+		// DueDate is the epic due date, the latest epic due date of the project, taken from the last snapshot
+		DueDate time.Time
+	}
+
+	BurnPoint struct {
+		Date         time.Time
+		Stories      int
+		StoriesDone  int
+		Estimate     float64
+		EstimateDone float64
+	}
+
+	// BurnOptions are the chart type, the epic and the report window of a burn chart
+	BurnOptions struct {
+		Type ChartType
+		Epic string
+		From time.Time
+		To   time.Time
+	}
+)
+
+// Scope returns the total stories, or the estimate if weighted
+func (b *Burn) Scope(p BurnPoint) float64 {
+	if b.Weighted {
+		return p.Estimate
+	}
+
+	return float64(p.Stories)
+}
+
+// Done returns the done stories, or the done estimate if weighted
+func (b *Burn) Done(p BurnPoint) float64 {
+	if b.Weighted {
+		return p.EstimateDone
+	}
+
+	return float64(p.StoriesDone)
+}
+
+// Burn collects the scope of the project, or of the epic if set, by the snapshot dates.
+// The snapshots the epic is missing from are skipped.
+func (d *Drawer) Burn(dates []time.Time, project, epic string) (Burn, error) {
+	dates = append([]time.Time(nil), dates...)
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	burn := Burn{Weighted: true}
+
+	for _, date := range dates {
+		summary, err := d.sg.GenerateSummary(date, project)
+		if err != nil {
+			return burn, fmt.Errorf("failed to generate summary for %s, %s. %s", date.Format(cache.DateFormat), project, err)
+		}
+
+		point := BurnPoint{Date: date}
+		dueDate := time.Time{}
+		found := false
+
+		for _, stats := range summary.Epics() {
+			if epic != "" && stats.Epic.Epic.Key != epic {
+				continue
+			}
+
+			found = true
+			point.Stories += stats.StoriesTotal
+			point.StoriesDone += stats.StoriesDone
+			point.Estimate += stats.Estimate
+			point.EstimateDone += stats.EstimateDone
+
+			if stats.Epic.DueDate.After(dueDate) {
+				dueDate = stats.Epic.DueDate
+			}
+		}
+
+		if !found {
+			continue
+		}
+
+		estimator := summary.Estimator()
+		burn.Weighted = burn.Weighted && estimator.Weighted()
+		burn.Unit = estimator.Unit()
+		burn.DueDate = dueDate
+		burn.Points = append(burn.Points, point)
+	}
+
+	if !burn.Weighted {
+		burn.Unit = "stories"
+	}
+
+	return burn, nil
+}
+
+// DrawBurn plots the scope against the done work for the burnup chart, the outstanding work for the burndown chart.
+// The ideal line runs from the first snapshot to the epic due date,
+// to the end of the report window or the latest epic due date for a project.
+func (d *Drawer) DrawBurn(project string, burn Burn, opts BurnOptions) error {
+	errFmt := "ChartGenerator.DrawBurn: %s"
+
+	if len(burn.Points) == 0 {
+		return fmt.Errorf(errFmt, "no snapshots to plot")
+	}
+
+	dates := make([]time.Time, 0, len(burn.Points))
+	scope := make([]float64, 0, len(burn.Points))
+	done := make([]float64, 0, len(burn.Points))
+	outstanding := make([]float64, 0, len(burn.Points))
+
+	maxValue := 0.0
+
+	for _, p := range burn.Points {
+		maxValue = math.Max(maxValue, burn.Scope(p))
+		dates = append(dates, p.Date)
+		scope = append(scope, burn.Scope(p))
+		done = append(done, burn.Done(p))
+		outstanding = append(outstanding, burn.Scope(p)-burn.Done(p))
+	}
+
+	first, last := burn.Points[0], burn.Points[len(burn.Points)-1]
+
+	target := burn.DueDate
+	if opts.Epic == "" && !opts.To.IsZero() {
+		target = opts.To
+	}
+
+	series := make([]chart.Series, 0, 3)
+	var ideal chart.TimeSeries
+
+	if opts.Type == TypeBurnDown {
+		series = append(series, timeSeries("Outstanding", dates, outstanding, drawing.ColorBlue))
+		ideal = timeSeries("Ideal", []time.Time{first.Date, target}, []float64{burn.Scope(first) - burn.Done(first), 0}, drawing.ColorBlack)
+	} else {
+		series = append(series,
+			timeSeries("Scope", dates, scope, drawing.ColorBlue),
+			timeSeries("Done", dates, done, drawing.ColorGreen),
+		)
+		ideal = timeSeries("Ideal", []time.Time{first.Date, target}, []float64{burn.Done(first), burn.Scope(last)}, drawing.ColorBlack)
+	}
+
+	if target.After(first.Date) {
+		ideal.Style.StrokeDashArray = []float64{5, 5}
+		series = append(series, ideal)
+	}
+
+	title := project
+	if opts.Epic != "" {
+		title += " " + opts.Epic
+	}
+
+	graph := chart.Chart{
+		Title:      fmt.Sprintf("%s %s", title, opts.Type),
+		TitleStyle: chart.StyleTextDefaults(),
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top:  60,
+				Left: 20,
+			},
+		},
+		Width:  810,
+		Height: 500,
+		XAxis: chart.XAxis{
+			Style:          chart.StyleTextDefaults(),
+			ValueFormatter: chart.TimeDateValueFormatter,
+		},
+		YAxis: chart.YAxis{
+			Name:  burn.Unit,
+			Style: chart.StyleTextDefaults(),
+			// the scope line is kept off the top edge
+			Range: &chart.ContinuousRange{Min: 0, Max: math.Max(maxValue*1.1, 1)},
+		},
+		Series: series,
+	}
+	graph.Elements = []chart.Renderable{chart.Legend(&graph)}
+
+	if !burn.Weighted {
+		graph.YAxis.ValueFormatter = chart.IntValueFormatter
+	}
+
+	f, err := util.CreateFile(path.Join(d.dir, project, burnFileName(burn, opts)))
+	if err != nil {
+		return fmt.Errorf(errFmt, err)
+	}
+	defer f.Close()
+
+	if err := graph.Render(chart.PNG, f); err != nil {
+		return fmt.Errorf(errFmt, err)
+	}
+
+	return nil
+}
+
+// burnFileName returns the chart file name, ex: burnup-EP-1-2026-07-01_2026-09-30.png
+func burnFileName(burn Burn, opts BurnOptions) string {
+	name := string(opts.Type)
+	if opts.Epic != "" {
+		name += "-" + opts.Epic
+	}
+
+	if !opts.From.IsZero() || !opts.To.IsZero() {
+		from, to := opts.From, opts.To
+		if from.IsZero() {
+			from = burn.Points[0].Date
+		}
+
+		if to.IsZero() {
+			to = burn.Points[len(burn.Points)-1].Date
+		}
+
+		name += "-" + from.Format(cache.DateFormat) + "_" + to.Format(cache.DateFormat)
+	}
+
+	return name + ".png"
+}
+
+func timeSeries(name string, dates []time.Time, values []float64, color drawing.Color) chart.TimeSeries {
+	return chart.TimeSeries{
+		Name:    name,
+		XValues: dates,
+		YValues: values,
+		Style: chart.Style{
+			StrokeColor: color,
+			StrokeWidth: 2,
+		},
+	}
+}
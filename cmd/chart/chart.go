@@ -22,10 +22,12 @@ type (
 		Stats []DataItem
 	}
 
+	// DataItem values are the issue estimates, the epic counts if not weighted
 	DataItem struct {
 		Name     string
-		Value    int
-		MaxValue int
+		Value    float64
+		MaxValue float64
+		Label    string
 	}
 )
 
@@ -58,7 +60,7 @@ func (d *Drawer) Draw(dates []time.Time, project string) error {
 				byDate = append(byDate, byDateItem)
 			}
 
-			byDateItem.Stats = append(byDateItem.Stats, DataItem{Name: stat.Name, Value: len(stat.Epics), MaxValue: summary.AllCount()})
+			byDateItem.Stats = append(byDateItem.Stats, dataItem(summary, stat))
 		}
 	}
 
@@ -94,8 +96,8 @@ func (d *Drawer) Draw(dates []time.Time, project string) error {
 		for _, stat := range bd.Stats {
 			color := colorByName(stat.Name)
 			barVal := chart.Value{
-				Label: fmt.Sprintf("%s (%d/%d)", stat.Name, stat.Value, stat.MaxValue),
-				Value: float64(stat.Value),
+				Label: stat.Label,
+				Value: stat.Value,
 				Style: chart.Style{
 					StrokeWidth: .01,
 					FillColor:   color,
@@ -123,6 +125,27 @@ func (d *Drawer) Draw(dates []time.Time, project string) error {
 	return f.Close()
 }
 
+func dataItem(summary calculator.Summary, stat calculator.NamedItems) DataItem {
+	estimator := summary.Estimator()
+	if !estimator.Weighted() {
+		return DataItem{
+			Name:     stat.Name,
+			Value:    float64(len(stat.Epics)),
+			MaxValue: float64(summary.AllCount()),
+			Label:    fmt.Sprintf("%s (%d/%d)", stat.Name, len(stat.Epics), summary.AllCount()),
+		}
+	}
+
+	value, maxValue := summary.Weight(stat.Epics), summary.AllWeight()
+
+	return DataItem{
+		Name:     stat.Name,
+		Value:    value,
+		MaxValue: maxValue,
+		Label:    fmt.Sprintf("%s (%s/%s)", stat.Name, estimator.FormatWeight(value), estimator.FormatWeight(maxValue)),
+	}
+}
+
 func colorByName(name string) drawing.Color {
 	switch name {
 	case "Done":
@@ -1,15 +1,19 @@
 package cmd
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/makarski/roadsnap/calculator"
 	"github.com/makarski/roadsnap/cmd/cache"
 	"github.com/makarski/roadsnap/cmd/chart"
+	"github.com/makarski/roadsnap/cmd/format"
 	"github.com/makarski/roadsnap/cmd/list"
 	"github.com/makarski/roadsnap/config"
 	"github.com/makarski/roadsnap/roadmap"
@@ -26,16 +30,136 @@ type (
 		Interactive bool
 		ConfigFile  string
 	}
+
+	CacheFlags struct {
+		EpicFrom           string
+		EpicTo             string
+		EpicWindow         string
+		EpicIncludeUndated optionalBool
+		Concurrency        int
+		Fresh              bool
+		Changelog          optionalBool
+	}
+
+	PruneFlags struct {
+		DryRun        bool
+		Project       string
+		DailyDays     int
+		WeeklyWeeks   int
+		MonthlyMonths int
+	}
+
+	MigrateStoreFlags struct {
+		FromDir   string
+		Overwrite bool
+	}
+
+	MigrateFlags struct {
+		DryRun bool
+	}
+
+	ExportFlags struct {
+		Out      string
+		Projects string
+		From     string
+		To       string
+	}
+
+	ImportFlags struct {
+		In        string
+		Overwrite bool
+		DryRun    bool
+	}
+
+	DiffFlags struct {
+		Project string
+		From    string
+		To      string
+		Format  string
+	}
+
+	ReportFlags struct {
+		Year        int
+		Granularity string
+		From        string
+		To          string
+		Format      string
+		Template    string
+	}
+
+	ChartFlags struct {
+		Type    string
+		Project string
+		Epic    string
+		From    string
+		To      string
+	}
+
+	ListFlags struct {
+		Format   string
+		Template string
+	}
+
+	HistoryFlags struct {
+		Project string
+		Epic    string
+		All     bool
+		Chronic bool
+	}
+
+	ForecastFlags struct {
+		Project string
+		Weeks   int
+		Runs    int
+		Seed    int64
+	}
 )
 
 var (
-	InArgs = Flags{}
+	InArgs           = Flags{}
+	CacheArgs        = CacheFlags{}
+	PruneArgs        = PruneFlags{}
+	MigrateStoreArgs = MigrateStoreFlags{}
+	MigrateArgs      = MigrateFlags{}
+	ExportArgs       = ExportFlags{}
+	ImportArgs       = ImportFlags{}
+	ForecastArgs     = ForecastFlags{}
+	HistoryArgs      = HistoryFlags{}
+	ReportArgs       = ReportFlags{}
+	DiffArgs         = DiffFlags{}
+	ListArgs         = ListFlags{}
+	ChartArgs        = ChartFlags{}
+
+	cmdFlags = map[string]*flag.FlagSet{
+		"cache":         cacheFlagSet(),
+		"prune":         pruneFlagSet(),
+		"migrate":       migrateFlagSet(),
+		"export":        exportFlagSet(),
+		"import":        importFlagSet(),
+		"forecast":      forecastFlagSet(),
+		"history":       historyFlagSet(),
+		"report":        reportFlagSet(),
+		"list":          listFlagSet(),
+		"chart":         chartFlagSet(),
+		"diff":          diffFlagSet(),
+		"migrate-store": migrateStoreFlagSet(),
+	}
 
 	cmds = map[string]CmdRunner{
-		"cache":  cacheCmd,
-		"list":   listCmd,
-		"chart":  chartCmd,
-		"report": TimeWindowReport,
+		"cache":    cacheCmd,
+		"list":     listCmd,
+		"chart":    chartCmd,
+		"report":   TimeWindowReport,
+		"verify":   verifyCmd,
+		"prune":    pruneCmd,
+		"forecast": forecastCmd,
+		"history":  historyCmd,
+		"diff":     diffCmd,
+
+		"export":        exportCmd,
+		"import":        importCmd,
+		"migrate":       migrateCmd,
+		"migrate-store": migrateStoreCmd,
 	}
 
 	out         = os.Stdout
@@ -43,24 +167,65 @@ var (
 	in          = os.Stdin
 )
 
-func chartCmd(cfg *config.Config) CmdFunc {
-	cacheReader := cache.NewEpicCacher(nil, InArgs.Dir)
-	summaryGenerator := calculator.NewCalculator(cfg.JiraCrd.BaseURL, cfg.StatusNames)
-	lister := list.NewLister(cacheReader, &summaryGenerator, InArgs.Dir)
-	drawer := chart.NewDrawer(lister, InArgs.Dir)
+func chartFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("chart", flag.ExitOnError)
+	fls.StringVar(&ChartArgs.Type, "type", string(chart.TypeStacked), "Chart type: stacked, burnup, burndown")
+	fls.StringVar(&ChartArgs.Project, "project", "", "Chart only the given project")
+	fls.StringVar(&ChartArgs.Epic, "epic", "", "Burn chart of the given epic key instead of the whole project")
+	fls.StringVar(&ChartArgs.From, "from", "", "Chart the snapshots taken on or after the date (YYYY-MM-DD)")
+	fls.StringVar(&ChartArgs.To, "to", "", "Chart the snapshots taken on or before the date (YYYY-MM-DD)")
+
+	return fls
+}
 
+func chartCmd(cfg *config.Config) CmdFunc {
 	return func() error {
-		projects, err := cache.ListSnapshotDates(InArgs.Dir, "")
+		chartType, err := chart.ParseChartType(ChartArgs.Type)
 		if err != nil {
 			return err
 		}
 
-		for _, project := range projects {
-			if len(project.Dates) == 0 {
-				fmt.Fprintf(out, "> Skipping project '%s' - no cached raw data\n", project.Project)
-				continue
-			}
+		if chartType == chart.TypeStacked && ChartArgs.Epic != "" {
+			return fmt.Errorf("-epic is supported by the burnup and burndown charts only")
+		}
+
+		from, err := parseDateArg("from", ChartArgs.From)
+		if err != nil {
+			return err
+		}
 
+		to, err := parseDateArg("to", ChartArgs.To)
+		if err != nil {
+			return err
+		}
+
+		estimator, err := calculator.NewEstimator(cfg.Estimate)
+		if err != nil {
+			return err
+		}
+
+		calendar, err := calculator.NewCalendar(cfg.Report.FiscalYearStart)
+		if err != nil {
+			return err
+		}
+
+		summaryGenerator := calculator.NewCalculator(cfg.JiraCrd.BaseURL, cfg.StatusNames, estimator, calendar)
+
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		lister := list.NewLister(store, &summaryGenerator, InArgs.Dir)
+		drawer := chart.NewDrawer(lister, InArgs.Dir)
+
+		projects, err := cache.ListSnapshotDates(store, ChartArgs.Project)
+		if err != nil {
+			return err
+		}
+
+		for _, project := range projects {
 			sort.Sort(sort.Reverse(sort.StringSlice(project.Dates)))
 
 			dates := make([]time.Time, 0, len(project.Dates))
@@ -70,11 +235,44 @@ func chartCmd(cfg *config.Config) CmdFunc {
 					return fmt.Errorf("failed to parse time for project: %s:%s. %s", project.Project, date, err)
 				}
 
+				if !from.IsZero() && t.Before(from) || !to.IsZero() && t.After(to) {
+					continue
+				}
+
 				dates = append(dates, t)
 			}
 
-			if err := drawer.Draw(dates, project.Project); err != nil {
-				return fmt.Errorf("failed to plot for project: %s. %s", project, err)
+			if len(dates) == 0 {
+				fmt.Fprintf(out, "> Skipping project '%s' - no cached raw data\n", project.Project)
+				continue
+			}
+
+			projectEstimator, err := estimator.ForSnapshots(store, project.Project, dates)
+			if err != nil {
+				return fmt.Errorf("failed to plot for project: %s. %s", project.Project, err)
+			}
+			summaryGenerator.SetEstimator(projectEstimator)
+
+			if chartType == chart.TypeStacked {
+				if err := drawer.Draw(dates, project.Project); err != nil {
+					return fmt.Errorf("failed to plot for project: %s. %s", project.Project, err)
+				}
+				continue
+			}
+
+			burn, err := drawer.Burn(dates, project.Project, ChartArgs.Epic)
+			if err != nil {
+				return fmt.Errorf("failed to plot for project: %s. %s", project.Project, err)
+			}
+
+			if len(burn.Points) < 2 {
+				fmt.Fprintf(out, "> Skipping project '%s' - at least 2 snapshots are needed, found: %d\n", project.Project, len(burn.Points))
+				continue
+			}
+
+			opts := chart.BurnOptions{Type: chartType, Epic: ChartArgs.Epic, From: from, To: to}
+			if err := drawer.DrawBurn(project.Project, burn, opts); err != nil {
+				return fmt.Errorf("failed to plot for project: %s. %s", project.Project, err)
 			}
 		}
 
@@ -82,26 +280,112 @@ func chartCmd(cfg *config.Config) CmdFunc {
 	}
 }
 
+// optionalBool is a bool flag which overrides the config value only if set
+type optionalBool struct {
+	set   bool
+	value bool
+}
+
+func (b *optionalBool) String() string {
+	if b == nil || !b.set {
+		return ""
+	}
+
+	return strconv.FormatBool(b.value)
+}
+
+func (b *optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+
+	b.set, b.value = true, v
+	return nil
+}
+
+func (b *optionalBool) IsBoolFlag() bool {
+	return true
+}
+
+func cacheFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("cache", flag.ExitOnError)
+	fls.StringVar(&CacheArgs.EpicFrom, "from", "", "Select epics starting on or after the date (YYYY-MM-DD). Overrides epic.from")
+	fls.StringVar(&CacheArgs.EpicTo, "to", "", "Select epics starting on or before the date (YYYY-MM-DD). Overrides epic.to")
+	fls.StringVar(&CacheArgs.EpicWindow, "window", "", "Select epics by a relative window, ex: 'last 18 months'. Overrides epic.window")
+	fls.Var(&CacheArgs.EpicIncludeUndated, "include-undated", "Include epics with no start date, -include-undated=false excludes them. Overrides epic.include_undated")
+	fls.IntVar(&CacheArgs.Concurrency, "concurrency", 0, "Number of epics fetched in parallel. Overrides fetch.concurrency")
+	fls.BoolVar(&CacheArgs.Fresh, "fresh", false, "Discard a partial snapshot of the same date instead of resuming it")
+	fls.Var(&CacheArgs.Changelog, "changelog", "Fetch the issue changelogs, -changelog=false skips them. Overrides fetch.changelog")
+
+	return fls
+}
+
 func cacheCmd(cfg *config.Config) CmdFunc {
 	snapshotDate := time.Now()
 
 	return func() error {
-		rv, err := roadmap.NewRoadmapViewer(cfg.JiraCrd)
+		epicCfg := *cfg.Epic
+		if CacheArgs.EpicFrom != "" || CacheArgs.EpicWindow != "" {
+			epicCfg.From, epicCfg.Window = CacheArgs.EpicFrom, CacheArgs.EpicWindow
+		}
+		if CacheArgs.EpicTo != "" {
+			epicCfg.To = CacheArgs.EpicTo
+		}
+		if CacheArgs.EpicIncludeUndated.set {
+			epicCfg.IncludeUndated = CacheArgs.EpicIncludeUndated.value
+		}
+
+		epicWindow, err := roadmap.NewEpicWindow(&epicCfg, snapshotDate)
 		if err != nil {
 			return err
 		}
 
-		cacher := cache.NewEpicCacher(rv, InArgs.Dir)
+		childLink, err := roadmap.ParseChildLink(cfg.Epic.ChildLink)
+		if err != nil {
+			return err
+		}
+
+		rv, err := roadmap.NewRoadmapViewer(cfg.JiraCrd, epicWindow, childLink, roadmap.NewRetryPolicy(cfg.Fetch))
+		if err != nil {
+			return err
+		}
+
+		changelog := cfg.Fetch.Changelog
+		if CacheArgs.Changelog.set {
+			changelog = CacheArgs.Changelog.value
+		}
+		rv.SetChangelog(changelog)
+
+		concurrency := cfg.Fetch.Concurrency
+		if CacheArgs.Concurrency > 0 {
+			concurrency = CacheArgs.Concurrency
+		}
+
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		cacher := cache.NewEpicCacher(rv, store)
+		cacher.SetOptions(cache.CacheOptions{
+			Concurrency: concurrency,
+			Resume:      !CacheArgs.Fresh,
+			StatusNames: cfg.StatusNames,
+		})
+
+		projects := cfg.Projects.List()
 
 		// cache all project and return
 		if !InArgs.Interactive {
-			fmt.Fprintln(out, "> Caching projects:\n  *", strings.Join(cfg.Projects.Names, "\n  * "))
-			return cacher.Cache(snapshotDate, cfg.Projects.Names)
+			fmt.Fprintln(out, "> Caching projects:\n  *", strings.Join(cfg.Projects.ListNames(), "\n  * "))
+			return cacher.Cache(snapshotDate, projects)
 		}
 
 		// pick a project interactively
-		for i, projectName := range cfg.Projects.Names {
-			fmt.Fprintf(interactOut, "  * %d: %s\n", i, projectName)
+		for i, project := range projects {
+			fmt.Fprintf(interactOut, "  * %d: %s\n", i, project.Name)
 		}
 
 		fmt.Fprintf(interactOut, "\n> Pick a project to cache (ex: 2): ")
@@ -111,27 +395,83 @@ func cacheCmd(cfg *config.Config) CmdFunc {
 			return err
 		}
 
-		project := cfg.Projects.Names[pPick]
+		if pPick < 0 || pPick >= len(projects) {
+			return fmt.Errorf("project index out of range: %d", pPick)
+		}
+
+		project := projects[pPick]
 
-		fmt.Fprintln(out, "> Caching project:", project)
+		fmt.Fprintln(out, "> Caching project:", project.Name)
 
-		return cacher.Cache(snapshotDate, []string{project})
+		return cacher.Cache(snapshotDate, []config.Project{project})
 	}
 }
 
-func listCmd(cfg *config.Config) CmdFunc {
-	cacheReader := cache.NewEpicCacher(nil, InArgs.Dir)
-	summaryGenerator := calculator.NewCalculator(cfg.JiraCrd.BaseURL, cfg.StatusNames)
-	lister := list.NewLister(cacheReader, &summaryGenerator, InArgs.Dir)
+func listFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("list", flag.ExitOnError)
+	fls.StringVar(&ListArgs.Format, "format", string(format.Markdown), "Summary file format: markdown, json, csv, html")
+	fls.StringVar(&ListArgs.Template, "template", "", "Markdown summary template file. Overrides templates.list")
 
+	return fls
+}
+
+func listCmd(cfg *config.Config) CmdFunc {
 	return func() error {
-		projects, err := cache.ListSnapshotDates(InArgs.Dir, "")
+		estimator, err := calculator.NewEstimator(cfg.Estimate)
+		if err != nil {
+			return err
+		}
+
+		outFormat, err := format.Parse(ListArgs.Format)
+		if err != nil {
+			return err
+		}
+
+		calendar, err := calculator.NewCalendar(cfg.Report.FiscalYearStart)
 		if err != nil {
 			return err
 		}
 
+		summaryGenerator := calculator.NewCalculator(cfg.JiraCrd.BaseURL, cfg.StatusNames, estimator, calendar)
+
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		tmpl, err := format.LoadTemplate("list", templatePath(ListArgs.Template, cfg.Templates.List), format.DefaultSummaryTemplate)
+		if err != nil {
+			return err
+		}
+
+		lister := list.NewLister(store, &summaryGenerator, InArgs.Dir)
+		lister.SetFormat(outFormat)
+		lister.SetTemplate(tmpl)
+
+		projects, err := cache.ListSnapshotDates(store, "")
+		if err != nil {
+			return err
+		}
+
+		// the estimate unit is decided once for all the snapshots of a project
+		useProjectEstimator := func(project *cache.CachedEntry) ([]time.Time, error) {
+			dates, err := parseSnapshotDates(project)
+			if err != nil {
+				return nil, err
+			}
+
+			projectEstimator, err := estimator.ForSnapshots(store, project.Project, dates)
+			if err != nil {
+				return nil, err
+			}
+
+			summaryGenerator.SetEstimator(projectEstimator)
+			return dates, nil
+		}
+
 		if InArgs.Interactive {
-			return interactListCmdHandler(lister, projects)
+			return interactListCmdHandler(lister, projects, useProjectEstimator)
 		}
 
 		for _, project := range projects {
@@ -142,12 +482,12 @@ func listCmd(cfg *config.Config) CmdFunc {
 
 			sort.Sort(sort.Reverse(sort.StringSlice(project.Dates)))
 
-			for _, date := range project.Dates {
-				t, err := time.Parse(dateFormat, date)
-				if err != nil {
-					return fmt.Errorf("failed to parse time for project: %s. %s", project.Project, err)
-				}
+			dates, err := useProjectEstimator(project)
+			if err != nil {
+				return fmt.Errorf("failed to list project: %s. %s", project.Project, err)
+			}
 
+			for _, t := range dates {
 				if err := lister.WriteReport(t, project.Project); err != nil {
 					return fmt.Errorf("failed to list project: %s. %s", project.Project, err)
 				}
@@ -158,7 +498,36 @@ func listCmd(cfg *config.Config) CmdFunc {
 	}
 }
 
-func interactListCmdHandler(lister *list.Lister, projects []*cache.CachedEntry) error {
+// parseSnapshotDates parses the cached snapshot dates of the project
+func parseSnapshotDates(project *cache.CachedEntry) ([]time.Time, error) {
+	dates := make([]time.Time, 0, len(project.Dates))
+
+	for _, date := range project.Dates {
+		t, err := time.Parse(dateFormat, date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse time for project: %s. %s", project.Project, err)
+		}
+
+		dates = append(dates, t)
+	}
+
+	return dates, nil
+}
+
+// templatePath returns the flag template path, or the configured one resolved against the work dir
+func templatePath(flagPath, cfgPath string) string {
+	if flagPath != "" || cfgPath == "" {
+		return flagPath
+	}
+
+	if path.IsAbs(cfgPath) {
+		return cfgPath
+	}
+
+	return path.Join(InArgs.Dir, cfgPath)
+}
+
+func interactListCmdHandler(lister *list.Lister, projects []*cache.CachedEntry, useProjectEstimator func(*cache.CachedEntry) ([]time.Time, error)) error {
 	for i, project := range projects {
 		fmt.Fprintf(interactOut, "\n  * %d: %s\n", i, project.Project)
 
@@ -174,18 +543,25 @@ func interactListCmdHandler(lister *list.Lister, projects []*cache.CachedEntry)
 		return err
 	}
 
+	if pPick < 0 || pPick >= len(projects) || dPick < 0 || dPick >= len(projects[pPick].Dates) {
+		return fmt.Errorf("project or date index out of range: %d, %d", pPick, dPick)
+	}
+
 	project := projects[pPick]
-	date := project.Dates[dPick]
 
-	t, err := time.Parse(dateFormat, date)
+	dates, err := useProjectEstimator(project)
 	if err != nil {
 		return err
 	}
 
-	return lister.WriteReport(t, project.Project)
+	return lister.WriteReport(dates[dPick], project.Project)
 }
 
-func Run(cmdName string) error {
+func Run(cmdName string, args []string) error {
+	if fls, ok := cmdFlags[cmdName]; ok {
+		fls.Parse(args)
+	}
+
 	cfg, err := config.LoadConfig(InArgs.ConfigFile)
 	if err != nil {
 		return err
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/makarski/roadsnap/calculator"
+	"github.com/makarski/roadsnap/config"
+)
+
+const (
+	diffFormatText = "text"
+	diffFormatJSON = "json"
+)
+
+func diffFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("diff", flag.ExitOnError)
+	fls.StringVar(&DiffArgs.Project, "project", "", "Project to compare")
+	fls.StringVar(&DiffArgs.From, "from", "", "Snapshot date to compare from (YYYY-MM-DD)")
+	fls.StringVar(&DiffArgs.To, "to", "", "Snapshot date to compare to (YYYY-MM-DD). Defaults to the latest snapshot")
+	fls.StringVar(&DiffArgs.Format, "format", diffFormatText, "Output format: text, json")
+
+	return fls
+}
+
+// diffCmd prints the epic and story changes between two snapshots of a project
+func diffCmd(cfg *config.Config) CmdFunc {
+	statusConverter := calculator.NewStatusConverter(cfg.StatusNames)
+
+	return func() error {
+		if DiffArgs.Project == "" || DiffArgs.From == "" {
+			return fmt.Errorf("-project and -from are required")
+		}
+
+		if DiffArgs.Format != diffFormatText && DiffArgs.Format != diffFormatJSON {
+			return fmt.Errorf("unsupported format: `%s`. expected one of: %s, %s", DiffArgs.Format, diffFormatText, diffFormatJSON)
+		}
+
+		from, err := parseDateArg("from", DiffArgs.From)
+		if err != nil {
+			return err
+		}
+
+		to, err := parseDateArg("to", DiffArgs.To)
+		if err != nil {
+			return err
+		}
+
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		if to.IsZero() {
+			dates, err := store.ListDates(DiffArgs.Project)
+			if err != nil {
+				return err
+			}
+
+			if len(dates) == 0 {
+				return fmt.Errorf("no snapshots cached for project: %s", DiffArgs.Project)
+			}
+
+			if to, err = parseDateArg("to", dates[len(dates)-1]); err != nil {
+				return err
+			}
+		}
+
+		differ := calculator.NewTimeWindowDiffer(cfg.JiraCrd.BaseURL+"browse", statusConverter, calculator.Estimator{}, store)
+
+		diff, err := differ.Diff(DiffArgs.Project, from, to)
+		if err != nil {
+			return fmt.Errorf("failed to compare snapshots: %s", err)
+		}
+
+		if DiffArgs.Format == diffFormatJSON {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(diff)
+		}
+
+		writeDiff(out, diff)
+
+		return nil
+	}
+}
+
+// writeDiff prints the changes grouped by epic
+func writeDiff(w io.Writer, diff *calculator.SnapshotDiff) {
+	fmt.Fprintf(w, "> %s: %s -> %s, %d change(s)\n",
+		diff.Project, diff.From.Format(viewDateFormat), diff.To.Format(viewDateFormat), len(diff.Changes))
+
+	epic := ""
+	for _, change := range diff.Changes {
+		if change.Epic != epic {
+			epic = change.Epic
+			fmt.Fprintf(w, "  * %s %s\n", change.Epic, change.EpicTitle)
+		}
+
+		if change.IsEpic() {
+			fmt.Fprintf(w, "    %s\n", formatChange(change))
+			continue
+		}
+
+		fmt.Fprintf(w, "    - %s %s: %s\n", change.Key, change.Title, formatChange(change))
+	}
+}
+
+func formatChange(change calculator.Change) string {
+	switch change.Kind {
+	case calculator.ChangeAdded:
+		return "added as " + change.To
+	case calculator.ChangeRemoved:
+		return "removed, was " + change.From
+	case calculator.ChangeReparented:
+		return "moved from " + change.From
+	case calculator.ChangeDueDate:
+		move := ""
+		if change.From != "" && change.To != "" {
+			move = " (" + formatSlipDays(change.Days) + ")"
+		}
+		return fmt.Sprintf("due date %s -> %s%s", orNone(change.From), orNone(change.To), move)
+	}
+
+	return fmt.Sprintf("%s %s -> %s", change.Kind, orNone(change.From), orNone(change.To))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+
+	return s
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/makarski/roadsnap/calculator"
+	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/config"
+	"github.com/makarski/roadsnap/util"
+)
+
+func forecastFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("forecast", flag.ExitOnError)
+	fls.StringVar(&ForecastArgs.Project, "project", "", "Forecast only the given project")
+	fls.IntVar(&ForecastArgs.Weeks, "weeks", 12, "Number of recent weeks the throughput is sampled from")
+	fls.IntVar(&ForecastArgs.Runs, "runs", 10000, "Number of simulation runs per epic")
+	fls.Int64Var(&ForecastArgs.Seed, "seed", 0, "Random seed for reproducible forecasts. Defaults to the current time")
+
+	return fls
+}
+
+// forecastCmd simulates the completion of the open epics from the latest snapshot
+// and writes the forecast next to the project reports
+func forecastCmd(cfg *config.Config) CmdFunc {
+	statusConverter := calculator.NewStatusConverter(cfg.StatusNames)
+
+	return func() error {
+		if ForecastArgs.Weeks < 1 || ForecastArgs.Runs < 1 {
+			return fmt.Errorf("-weeks and -runs must be positive")
+		}
+
+		seed := ForecastArgs.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		forecaster := calculator.NewForecaster(statusConverter, ForecastArgs.Runs, seed)
+
+		projects, err := cache.ListSnapshotDates(store, ForecastArgs.Project)
+		if err != nil {
+			return err
+		}
+
+		for _, project := range projects {
+			sort.Strings(project.Dates)
+			latest, err := time.Parse(dateFormat, project.Dates[len(project.Dates)-1])
+			if err != nil {
+				return fmt.Errorf("failed to parse time for project: %s. %s", project.Project, err)
+			}
+
+			throughput, err := calculator.WeeklyThroughput(store, statusConverter, project.Project, ForecastArgs.Weeks, latest)
+			if err != nil {
+				return fmt.Errorf("failed to calculate throughput for project: %s. %s", project.Project, err)
+			}
+
+			total := 0.0
+			for _, t := range throughput {
+				total += t
+			}
+
+			if total == 0 {
+				fmt.Fprintf(out, "> Skipping project '%s' - no stories done in the snapshots of the last %d week(s)\n",
+					project.Project, ForecastArgs.Weeks)
+				continue
+			}
+
+			epics, err := cache.FromCacheOrdered(store, latest, project.Project)
+			if err != nil {
+				return err
+			}
+
+			forecasts := forecaster.Forecast(epics, throughput, latest)
+
+			fileKey := path.Join(InArgs.Dir, util.RemoveSpaces(project.Project), "forecast.md")
+			f, err := util.CreateFile(fileKey)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprint(f, forecastToMarkdown(project.Project, latest, throughput, ForecastArgs.Runs, forecasts))
+			f.Close()
+
+			fmt.Fprintf(out, "> Forecast for project: %s, %d open epic(s): %s\n", project.Project, len(forecasts), fileKey)
+
+			for _, fc := range forecasts {
+				if risk := fc.Risk(); risk == calculator.ForecastAtRisk || risk == calculator.ForecastLikelyLate {
+					fmt.Fprintf(out, "  * %s: %s, P85 %s, due %s\n",
+						fc.Epic.Epic.Key, risk, fc.P85.Format(viewDateFormat), fc.Epic.DueDate.Format(viewDateFormat))
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+func forecastToMarkdown(project string, from time.Time, throughput []float64, runs int, forecasts []calculator.EpicForecast) string {
+	var buf bytes.Buffer
+
+	total := 0.0
+	for _, t := range throughput {
+		total += t
+	}
+
+	fmt.Fprintf(&buf, `
+%s: Forecast as of %s
+======
+
+Throughput: %.1f stories per week on average over %d week(s), %d simulation runs.  
+The open epics share the throughput and are worked in the order of their due dates.
+
+| Epic Name | Remaining | Due Date | P50 | P85 | P95 | On Time | Risk |
+| ---       | ---       | ---      | --- | --- | --- | ---     | ---  |`,
+		project, from.Format(viewDateFormat), total/float64(len(throughput)), len(throughput), runs)
+
+	for _, fc := range forecasts {
+		dueDate := "-"
+		if !fc.Epic.DueDate.IsZero() {
+			dueDate = fc.Epic.DueDate.Format(viewDateFormat)
+		}
+
+		fmt.Fprintf(&buf, `
+| %s %s | %d | %s | %s | %s | %s | %.0f%% | %s |`,
+			fc.Epic.Epic.Key,
+			fc.Epic.Epic.Fields.Summary,
+			fc.Remaining,
+			dueDate,
+			fc.P50.Format(viewDateFormat),
+			fc.P85.Format(viewDateFormat),
+			fc.P95.Format(viewDateFormat),
+			fc.OnTime*100,
+			fc.Risk(),
+		)
+	}
+
+	buf.WriteString("\n")
+
+	return buf.String()
+}
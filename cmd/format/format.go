@@ -0,0 +1,103 @@
+// Package format renders the summaries and the reports as JSON and CSV for the spreadsheets and dashboards,
+// and as self-contained HTML pages.
+// The schemas are versioned by SchemaVersion, the fields are only added within a version.
+package format
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/makarski/roadsnap/calculator"
+	"github.com/makarski/roadsnap/cmd/cache"
+)
+
+// SchemaVersion is bumped on the breaking changes of the JSON and CSV schemas
+const SchemaVersion = 1
+
+// Format is the output format of the list and report commands
+type Format string
+
+const (
+	Markdown Format = "markdown"
+	JSON     Format = "json"
+	CSV      Format = "csv"
+	HTML     Format = "html"
+)
+
+func Parse(s string) (Format, error) {
+	switch f := Format(s); f {
+	case Markdown, JSON, CSV, HTML:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("unsupported format: `%s`. expected one of: %s, %s, %s, %s", s, Markdown, JSON, CSV, HTML)
+}
+
+// Ext is the file extension of the format
+func (f Format) Ext() string {
+	switch f {
+	case JSON:
+		return ".json"
+	case CSV:
+		return ".csv"
+	case HTML:
+		return ".html"
+	}
+
+	return ".md"
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+
+	return cw.Error()
+}
+
+// date formats the date as YYYY-MM-DD, empty for the zero date
+func date(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(cache.DateFormat)
+}
+
+// days converts the duration to days rounded to 2 decimals
+func days(d time.Duration) float64 {
+	return round(d.Hours() / 24)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func num(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func unit(e calculator.Estimator) string {
+	if !e.Weighted() {
+		return "count"
+	}
+
+	return e.Unit()
+}
@@ -0,0 +1,315 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"time"
+
+	"github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
+
+	"github.com/makarski/roadsnap/calculator"
+	"github.com/makarski/roadsnap/cmd/cache"
+)
+
+const (
+	htmlChartWidth  = 900
+	htmlChartHeight = 300
+)
+
+// WriteSummaryHTML writes the summary as a single html page with the embedded styles and scripts
+func WriteSummaryHTML(w io.Writer, doc SummaryDoc) error {
+	counts := make(map[string]float64)
+	names := make([]string, 0)
+
+	for _, epic := range doc.Epics {
+		if _, ok := counts[epic.Category]; !ok {
+			names = append(names, epic.Category)
+		}
+		counts[epic.Category]++
+	}
+
+	bars := make([]chart.Value, 0, len(names))
+	for _, name := range names {
+		bars = append(bars, chart.Value{Label: fmt.Sprintf("%s (%.0f)", name, counts[name]), Value: counts[name]})
+	}
+
+	svg, err := barChartSVG(bars, float64(len(doc.Epics)))
+	if err != nil {
+		return err
+	}
+
+	return summaryHTML.Execute(w, struct {
+		SummaryDoc
+		Chart       template.HTML
+		GeneratedAt time.Time
+	}{doc, svg, time.Now()})
+}
+
+// WriteReportHTML writes the report and the due date history as a single html page
+// with the embedded styles and scripts. The history epics are linked as: <linkPrefix>/<key>
+func WriteReportHTML(w io.Writer, doc ReportDoc, histories []calculator.SlipHistory, linkPrefix string) error {
+	bars := make([]chart.Value, 0, len(doc.Periods))
+	for _, period := range doc.Periods {
+		bars = append(bars, chart.Value{Label: period.Title, Value: period.Progress * 100})
+	}
+
+	svg, err := barChartSVG(bars, 100)
+	if err != nil {
+		return err
+	}
+
+	changed := make([]calculator.SlipHistory, 0, len(histories))
+	for _, history := range histories {
+		if len(history.Changes) > 0 {
+			changed = append(changed, history)
+		}
+	}
+
+	return reportHTML.Execute(w, struct {
+		ReportDoc
+		Chart       template.HTML
+		Histories   []calculator.SlipHistory
+		LinkPrefix  string
+		GeneratedAt time.Time
+	}{doc, svg, changed, linkPrefix, time.Now()})
+}
+
+// barChartSVG renders the bars as an inline svg, empty if there is nothing to draw
+func barChartSVG(bars []chart.Value, max float64) (template.HTML, error) {
+	if len(bars) == 0 || max <= 0 {
+		return "", nil
+	}
+
+	spacing := 10
+	barWidth := int(math.Max(8, float64((htmlChartWidth-140)/len(bars)-spacing)))
+
+	for i := range bars {
+		bars[i].Style = chart.Style{FillColor: drawing.ColorFromHex("1f6feb"), StrokeColor: drawing.ColorFromHex("1f6feb")}
+	}
+
+	bc := chart.BarChart{
+		Width:      htmlChartWidth,
+		Height:     htmlChartHeight,
+		BarWidth:   barWidth,
+		BarSpacing: spacing,
+		Background: chart.Style{Padding: chart.Box{Top: 20}},
+		XAxis:      chart.StyleTextDefaults(),
+		YAxis: chart.YAxis{
+			Style: chart.StyleTextDefaults(),
+			Range: &chart.ContinuousRange{Min: 0, Max: max},
+		},
+		Bars: bars,
+	}
+
+	var buf bytes.Buffer
+	if err := bc.Render(chart.SVG, &buf); err != nil {
+		return "", fmt.Errorf("failed to render chart. %s", err)
+	}
+
+	return template.HTML(buf.String()), nil
+}
+
+var htmlFuncs = template.FuncMap{
+	"percent": func(v float64) string { return fmt.Sprintf("%.0f%%", v*100) },
+	"signed":  func(v float64) string { return fmt.Sprintf("%+.0f%%", v*100) },
+	"days": func(v float64) string {
+		if v == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1fd", v)
+	},
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return "not set"
+		}
+		return t.Format(cache.DateFormat)
+	},
+	"datetime": func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+	"num":      num,
+}
+
+var summaryHTML = template.Must(template.New("summary").Funcs(htmlFuncs).Parse(htmlHead + `
+<h1>{{.Project}}: {{.Date}}</h1>
+<p class="meta">Generated {{datetime .GeneratedAt}}, estimate: {{.EstimateUnit}}</p>
+{{if .Chart}}<figure class="chart">{{.Chart}}</figure>{{end}}
+<input class="filter" data-table="epics" placeholder="Filter epics">
+<table class="sortable" id="epics">
+<thead><tr>
+<th>Epic</th><th>Category</th><th>Status</th><th>Labels</th><th>Start</th><th>Due</th><th>Quarter</th>
+<th>Stories</th><th>Done</th><th>In Progress</th><th>To Do</th><th>Estimate</th><th>Progress</th>
+</tr></thead>
+<tbody>
+{{- range .Epics}}
+<tr>
+<td><a href="{{.Link}}">{{.Key}}</a> {{.Title}}</td>
+<td>{{.Category}}</td><td>{{.Status}}</td><td>{{range $i, $l := .Labels}}{{if $i}}, {{end}}<code>{{$l}}</code>{{end}}</td>
+<td>{{.StartDate}}</td><td>{{.DueDate}}</td><td>{{.Quarter}}</td>
+<td data-sort="{{.StoriesTotal}}">{{.StoriesTotal}}</td><td data-sort="{{.StoriesDone}}">{{.StoriesDone}}</td>
+<td data-sort="{{.StoriesInProgress}}">{{.StoriesInProgress}}</td><td data-sort="{{.StoriesToDo}}">{{.StoriesToDo}}</td>
+<td data-sort="{{.EstimateTotal}}">{{num .EstimateDone}} / {{num .EstimateTotal}}</td>
+<td data-sort="{{.Progress}}"><span class="bar"><span style="width: {{percent .Progress}}"></span></span> {{percent .Progress}}</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+` + htmlFoot))
+
+var reportHTML = template.Must(template.New("report").Funcs(htmlFuncs).Parse(htmlHead + `
+<h1>{{.Project}}: {{.From}} - {{.To}}</h1>
+<p class="meta">Generated {{datetime .GeneratedAt}}, by {{.Granularity}}</p>
+{{if .Chart}}<figure class="chart">{{.Chart}}<figcaption>Progress by {{.Granularity}}, %</figcaption></figure>{{end}}
+<table class="sortable">
+<thead><tr>
+<th>Period</th><th>Snapshot From</th><th>Snapshot To</th><th>Progress</th><th>Epics Planned</th><th>Epics Done</th>
+<th>Stories Planned</th><th>Stories Done</th><th>Scope</th><th>Cycle Time</th><th>Lead Time</th>
+</tr></thead>
+<tbody>
+{{- range $i, $p := .Periods}}
+<tr>
+<td data-sort="{{$p.From}}"><a href="#period-{{$i}}">{{$p.Title}}</a></td>
+<td>{{$p.SnapshotFrom}}</td><td>{{$p.SnapshotTo}}</td>
+<td data-sort="{{$p.Progress}}">{{percent $p.Progress}}</td>
+<td data-sort="{{$p.EpicsPlannedTo}}">{{$p.EpicsPlannedFrom}} &rarr; {{$p.EpicsPlannedTo}}</td>
+<td data-sort="{{$p.EpicsDoneTo}}">{{$p.EpicsDoneFrom}} &rarr; {{$p.EpicsDoneTo}}</td>
+<td data-sort="{{$p.EstimatePlannedTo}}">{{num $p.EstimatePlannedFrom}} &rarr; {{num $p.EstimatePlannedTo}}</td>
+<td data-sort="{{$p.EstimateDoneTo}}">{{num $p.EstimateDoneFrom}} &rarr; {{num $p.EstimateDoneTo}}</td>
+<td data-sort="{{$p.ScopeChange}}">{{signed $p.ScopeChange}}</td>
+<td data-sort="{{$p.CycleTimeMedianDays}}">{{days $p.CycleTimeMedianDays}} / {{days $p.CycleTimeP85Days}}</td>
+<td data-sort="{{$p.LeadTimeMedianDays}}">{{days $p.LeadTimeMedianDays}} / {{days $p.LeadTimeP85Days}}</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+<p class="meta">{{if .Periods}}Estimate: {{(index .Periods 0).EstimateUnit}}. {{end}}Cycle Time: first in progress to done, Lead Time: created to done. Median / P85 in days.</p>
+
+{{range $i, $p := .Periods}}
+<details id="period-{{$i}}"{{if $p.Epics}} open{{end}}>
+<summary>{{$p.Title}} <span class="meta">{{$p.From}} - {{$p.To}}, {{len $p.Epics}} epic(s), progress {{percent $p.Progress}}</span></summary>
+<p class="meta">Snapshot From: {{$p.SnapshotFrom}}, Snapshot To: {{$p.SnapshotTo}}{{if $p.FromChangelog}}, states reconstructed from the changelogs{{end}}</p>
+{{- if $p.Epics}}
+<input class="filter" data-table="epics-{{$i}}" placeholder="Filter epics">
+<table class="sortable" id="epics-{{$i}}">
+<thead><tr>
+<th>Epic</th><th>Status</th><th>Planning</th><th>Due Date</th><th>Progress</th><th>Stories Total</th><th>Stories Done</th>
+<th>Scope</th><th>Cycle Time</th><th>Lead Time</th>
+</tr></thead>
+<tbody>
+{{- range $p.Epics}}
+<tr>
+<td><a href="{{.Link}}">{{.Key}}</a> {{.Title}}</td>
+<td>{{.StatusFrom}} &rarr; {{.StatusTo}}</td>
+<td class="planning-{{.PlanningStatus}}">{{.PlanningStatus}}</td>
+<td data-sort="{{.DueDateTo}}">{{.DueDateFrom}} &rarr; {{.DueDateTo}}</td>
+<td data-sort="{{.Progress}}"><span class="bar"><span style="width: {{percent .Progress}}"></span></span> {{percent .Progress}}</td>
+<td data-sort="{{.EstimateTo}}">{{num .EstimateFrom}} &rarr; {{num .EstimateTo}}</td>
+<td data-sort="{{.EstimateDoneTo}}">{{num .EstimateDoneFrom}} &rarr; {{num .EstimateDoneTo}}</td>
+<td data-sort="{{.ScopeChange}}">{{signed .ScopeChange}}{{if or .StoriesAdded .StoriesRemoved .StoriesReparented}} (+{{.StoriesAdded}}, -{{.StoriesRemoved}}, ~{{.StoriesReparented}}){{end}}</td>
+<td data-sort="{{.CycleTimeMedianDays}}">{{days .CycleTimeMedianDays}} / {{days .CycleTimeP85Days}}</td>
+<td data-sort="{{.LeadTimeMedianDays}}">{{days .LeadTimeMedianDays}} / {{days .LeadTimeP85Days}}</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+</details>
+{{end}}
+
+{{- if .Histories}}
+<details open>
+<summary>Due Date History</summary>
+<table class="sortable">
+<thead><tr>
+<th>Epic</th><th>First Seen</th><th>Initial Due Date</th><th>Current Due Date</th><th>Reschedules</th><th>Cumulative Slip</th><th>Changes</th>
+</tr></thead>
+<tbody>
+{{- range .Histories}}
+<tr{{if .Chronic}} class="chronic"{{end}}>
+<td><a href="{{$.LinkPrefix}}/{{.Key}}">{{.Key}}</a> {{.Title}}{{if .Chronic}} <strong>(chronic)</strong>{{end}}</td>
+<td>{{date .FirstSeen}}</td><td>{{date .Initial}}</td><td>{{date .Current}}</td>
+<td data-sort="{{.Reschedules}}">{{.Reschedules}}</td>
+<td data-sort="{{.CumulativeSlip}}">{{printf "%+d" .CumulativeSlip}} days</td>
+<td><ul>{{range .Changes}}<li>{{date .ObservedAt}}: {{date .From}} &rarr; {{date .To}} ({{printf "%+d" .Days}} days)</li>{{end}}</ul></td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+</details>
+{{- end}}
+` + htmlFoot))
+
+const htmlHead = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>roadsnap</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; width: 100%; margin: 0.5em 0 1.5em; font-size: 14px; }
+th, td { border: 1px solid #d0d7de; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; cursor: pointer; user-select: none; white-space: nowrap; }
+th[data-order="asc"]::after { content: " \25B2"; }
+th[data-order="desc"]::after { content: " \25BC"; }
+tr:nth-child(even) { background: #fafbfc; }
+tr.chronic { background: #fff1f0; }
+td ul { margin: 0; padding-left: 1.2em; }
+a { color: #0969da; text-decoration: none; }
+details { margin: 1em 0; }
+summary { font-size: 1.2em; font-weight: 600; cursor: pointer; }
+.meta { color: #57606a; font-size: 13px; font-weight: normal; }
+.filter { padding: 4px 8px; width: 20em; }
+.bar { display: inline-block; width: 60px; height: 8px; background: #eaeef2; vertical-align: middle; }
+.bar span { display: block; height: 100%; background: #1f6feb; }
+.planning-Postponed, .planning-Replanned { color: #cf222e; }
+.planning-Advanced { color: #1a7f37; }
+.chart svg { max-width: 100%; height: auto; }
+</style>
+</head>
+<body>
+`
+
+const htmlFoot = `
+<script>
+(function () {
+  function value(cell) {
+    var v = cell.getAttribute("data-sort");
+    if (v !== null && v !== "" && !isNaN(v)) {
+      return parseFloat(v);
+    }
+    return (v !== null ? v : cell.textContent).trim().toLowerCase();
+  }
+
+  document.querySelectorAll("table.sortable").forEach(function (table) {
+    var headers = table.querySelectorAll("th");
+    headers.forEach(function (th, i) {
+      th.addEventListener("click", function () {
+        var asc = th.getAttribute("data-order") !== "asc";
+        headers.forEach(function (h) { h.removeAttribute("data-order"); });
+        th.setAttribute("data-order", asc ? "asc" : "desc");
+
+        var body = table.tBodies[0];
+        Array.prototype.slice.call(body.rows).sort(function (a, b) {
+          var x = value(a.cells[i]), y = value(b.cells[i]);
+          return (x < y ? -1 : x > y ? 1 : 0) * (asc ? 1 : -1);
+        }).forEach(function (row) { body.appendChild(row); });
+      });
+    });
+  });
+
+  document.querySelectorAll("input.filter").forEach(function (input) {
+    input.addEventListener("input", function () {
+      var query = input.value.trim().toLowerCase();
+      var table = document.getElementById(input.getAttribute("data-table"));
+      Array.prototype.forEach.call(table.tBodies[0].rows, function (row) {
+        row.style.display = row.textContent.toLowerCase().indexOf(query) === -1 ? "none" : "";
+      });
+    });
+  });
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,276 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/makarski/roadsnap/calculator"
+)
+
+const (
+	viewDateFormat = "Jan 2, 2006"
+	longDateFormat = "January 2, 2006"
+)
+
+// SummaryData is the data of the list markdown template, the embedded Summary fields and methods are available too:
+//
+//	.Project, .Date - the snapshot project and date
+//	.AllCount - the number of the summary epics
+//	.Estimator - the estimator the progress is weighted by, see: .Estimator.Weighted, .Estimator.FormatWeight
+//	.Groups - the epics by category: Done, Ongoing, Overdue, To Do
+type SummaryData struct {
+	*calculator.Summary
+	Groups []SummaryGroup
+}
+
+// SummaryGroup are the epics of a summary category.
+// Each calculator.SummaryEpic has: .Category, .Epic (cache.EpicLink with the jira .Epic.Epic issue, .Epic.StartDate, .Epic.DueDate),
+// .Link, .Alert, .Quarter, .StoriesTotal, .StoriesDone, .StoriesInProgress, .StoriesToDo, .Estimate, .EstimateDone, .Progress
+type SummaryGroup struct {
+	Name  string
+	Epics []calculator.SummaryEpic
+}
+
+// ReportData is the data of the report markdown template:
+//
+//	.Reports - a calculator.Report2 per period with the .EpicPairs (calculator.Pair) of the period,
+//	  each pair holds the .Left and .Right calculator.PlanEpic with their .PlanStories (calculator.PlanStory)
+//	.Histories - the due date histories (calculator.SlipHistory) of the epics whose due date changed
+type ReportData struct {
+	Project     string
+	Granularity calculator.Granularity
+	From        time.Time
+	To          time.Time
+	Reports     []calculator.Report2
+	Histories   []calculator.SlipHistory
+}
+
+// MarkdownFuncs are the helper functions available in the markdown templates:
+//
+//	date, longDate, isoDate: formats the date as "Jan 2, 2006", "January 2, 2006" or "2006-01-02"
+//	formatDate LAYOUT DATE: formats the date with a go time layout
+//	dueDate: formats the date as "Jan 2, 2006", "not set" for the zero date
+//	ratio: formats the number with 2 decimals, ex: 0.25
+//	percent, signedPercent: formats the ratio as percents, ex: 25%, +25%
+//	slip: formats the days with a sign, ex: +14 days
+//	estimate ESTIMATOR COUNT ESTIMATE: the story count followed by the estimate if weighted, ex: 5 (13 pts)
+//	link PREFIX KEY: the jira link of the issue key
+//	labels: the labels as inline code, ex: `a`, `b`
+//	join SEP LIST: joins the strings
+//	anchor REPORT: the report period anchor name
+//	scope PAIR: the epic scope change with the story counts, ex: +20% (+2, -1, ~0)
+//	scopeChanges PAIR: the added, removed and moved stories of the epic
+var MarkdownFuncs = template.FuncMap{
+	"date":          func(t time.Time) string { return t.Format(viewDateFormat) },
+	"longDate":      func(t time.Time) string { return t.Format(longDateFormat) },
+	"isoDate":       date,
+	"formatDate":    func(layout string, t time.Time) string { return t.Format(layout) },
+	"dueDate":       dueDate,
+	"ratio":         func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"percent":       func(v float64) string { return fmt.Sprintf("%.0f%%", v*100) },
+	"signedPercent": signedPercent,
+	"slip":          func(days int) string { return fmt.Sprintf("%+d days", days) },
+	"estimate":      withEstimate,
+	"link":          func(prefix, key string) string { return prefix + "/" + key },
+	"labels":        labels,
+	"join":          func(sep string, s []string) string { return strings.Join(s, sep) },
+	"anchor":        func(report calculator.Report2) string { return date(report.From) },
+	"scope":         epicScope,
+	"scopeChanges":  scopeChanges,
+}
+
+// DefaultSummaryTemplate is the built-in list markdown layout
+const DefaultSummaryTemplate = `
+{{.Project}}: {{longDate .Date}}
+======================
+{{range .Groups}}
+{{.Name}} ({{len .Epics}}/{{$.AllCount}})
+----------------------
+{{range .Epics}}
+#### {{.Quarter}} [{{.Epic.Epic.Key}}]({{.Link}}): {{.Epic.Epic.Fields.Summary}}
+{{with .Alert}}
+> {{.}}
+{{end}}
+{{labels .Epic.Epic.Fields.Labels}}  
+Status: {{.Epic.Epic.Fields.Status.Name}}  
+Start: {{longDate .Epic.StartDate}}  
+Due: {{longDate .Epic.DueDate}}  
+Total: {{.StoriesTotal}}, Done: {{.StoriesDone}}, InProgress: {{.StoriesInProgress}}, Outstanding: {{.StoriesToDo}}  
+{{if $.Estimator.Weighted}}Estimate: {{$.Estimator.FormatWeight .EstimateDone}} of {{$.Estimator.FormatWeight .Estimate}}  
+{{end}}Progress: {{ratio .Progress}}
+{{end}}{{end}}`
+
+// DefaultReportTemplate is the built-in report markdown layout
+const DefaultReportTemplate = `
+{{.Project}}: {{date .From}} - {{date .To}}
+======
+
+| {{.Granularity.Label}} | Snapshot From | Snapshot To | Progress | Epics Planned | Epics Done | Stories Planned | Stories Done | Scope | Cycle Time | Lead Time |
+| ---   | ---           | ---         | ---      | ---           | ---        | ---             | ---          | ---   | ---        | ---       |
+{{- range .Reports}}
+| [{{.Title}}](#{{anchor .}}) |{{date .SnapshotFrom}} | {{date .SnapshotTo}} | {{ratio .Progress}} | {{.LeftEpicsPlanned}} -> {{.RightEpicsPlanned}} | {{.LeftEpicsDone}} -> {{.RightEpicsDone}} | **{{estimate .Estimator .LeftStoriesPlanned .LeftEstimatePlanned}}** -> {{estimate .Estimator .RightStoriesPlanned .RightEstimatePlanned}} | {{estimate .Estimator .LeftStoriesDone .LeftEstimateDone}} -> **{{estimate .Estimator .RightStoriesDone .RightEstimateDone}}** | {{signedPercent .ScopeChange}} | {{.Flow.CycleTime.Days}} | {{.Flow.LeadTime.Days}} |
+{{- end}}
+
+Scope: net change of the stories of the epics in both snapshots. Cycle Time: first in progress to done, Lead Time: created to done. Median / P85 in days.
+{{range $report := .Reports}}
+---
+<a name="{{anchor .}}"></a>{{.Title}}
+===
+
+Snapshot From: {{date .SnapshotFrom}}  
+Snapshot To: {{date .SnapshotTo}}  
+{{if .FromChangelog}}States reconstructed from the changelogs as of: {{date .From}} - {{date .To}}  
+{{end}}		
+| Epic Name | Status | Planning | Due Date | Progress | Stories Total | Stories Done | Scope | Cycle Time | Lead Time |
+| ---       | ---    | ---      | ---      | ---      | ---		      | ---          | ---   | ---        | ---       |
+{{- range .EpicPairs}}
+| [{{.Key}}]({{.Link}}) {{.Title}} | {{.Left.Status}} -> {{.Right.Status}} | {{.PlanningStatus}} | {{.LeftDueDate "Jan 2, 2006"}} -> {{.RightDueDate "Jan 2, 2006"}} | {{ratio .Progress}} | **{{estimate $report.Estimator (len .Left.PlanStories) .Left.Estimate}}** -> {{estimate $report.Estimator (len .Right.PlanStories) .Right.Estimate}} | {{estimate $report.Estimator .Left.StoriesDone .Left.EstimateDone}} -> **{{estimate $report.Estimator .Right.StoriesDone .Right.EstimateDone}}** | {{scope .}} | {{.Right.Flow.CycleTime.Days}} | {{.Right.Flow.LeadTime.Days}} |
+{{- end}}
+{{- if .HasScopeChanges}}
+
+Scope changes:
+{{range .EpicPairs}}{{if .HasScopeChanges}}* {{.Key}}: {{scopeChanges .}}
+{{end}}{{end}}{{- end}}
+{{- end}}
+{{- if .Histories}}
+
+---
+<a name="due-date-history"></a>Due Date History
+===
+
+| Epic Name | First Seen | Initial Due Date | Current Due Date | Reschedules | Cumulative Slip |
+| ---       | ---        | ---              | ---              | ---         | ---             |
+{{- range .Histories}}
+| {{if .Chronic}}**{{.Key}} {{.Title}}** (chronic){{else}}{{.Key}} {{.Title}}{{end}} | {{date .FirstSeen}} | {{dueDate .Initial}} | {{dueDate .Current}} | {{.Reschedules}} | {{slip .CumulativeSlip}} |
+{{- end}}
+
+{{range .Histories}}* {{.Key}}: {{range $i, $c := .Changes}}{{if $i}}; {{end}}{{date .ObservedAt}}: {{dueDate .From}} -> {{dueDate .To}} ({{slip .Days}}){{end}}
+{{end}}{{- end}}`
+
+// LoadTemplate parses the template file, the default template if the path is empty
+func LoadTemplate(name, path, def string) (*template.Template, error) {
+	text, source := def, name
+
+	if path != "" {
+		source = path
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %s. %s", path, err)
+		}
+		text = string(b)
+	}
+
+	tmpl, err := template.New(name).Funcs(MarkdownFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %s. %s", source, err)
+	}
+
+	return tmpl, nil
+}
+
+// WriteSummaryMarkdown renders the summary with the list template
+func WriteSummaryMarkdown(w io.Writer, tmpl *template.Template, summary *calculator.Summary) error {
+	data := SummaryData{Summary: summary}
+	epics := summary.Epics()
+
+	for _, item := range summary.NamedStats() {
+		group := SummaryGroup{Name: item.Name, Epics: make([]calculator.SummaryEpic, 0, len(item.Epics))}
+
+		for _, epic := range epics {
+			if epic.Category == item.Name {
+				group.Epics = append(group.Epics, epic)
+			}
+		}
+
+		data.Groups = append(data.Groups, group)
+	}
+
+	return tmpl.Execute(w, data)
+}
+
+// WriteReportMarkdown renders the report with the report template
+func WriteReportMarkdown(w io.Writer, tmpl *template.Template, data ReportData) error {
+	histories := make([]calculator.SlipHistory, 0, len(data.Histories))
+	for _, history := range data.Histories {
+		if len(history.Changes) > 0 {
+			histories = append(histories, history)
+		}
+	}
+	data.Histories = histories
+
+	return tmpl.Execute(w, data)
+}
+
+func dueDate(t time.Time) string {
+	if t.IsZero() {
+		return "not set"
+	}
+
+	return t.Format(viewDateFormat)
+}
+
+func signedPercent(v float64) string {
+	return fmt.Sprintf("%+.0f%%", v*100)
+}
+
+func labels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	return "`" + strings.Join(labels, "`, `") + "`"
+}
+
+// withEstimate appends the estimate to the story count if the progress is weighted
+func withEstimate(estimator calculator.Estimator, count int, estimate float64) string {
+	if !estimator.Weighted() {
+		return fmt.Sprintf("%d", count)
+	}
+
+	return fmt.Sprintf("%d (%s)", count, estimator.FormatWeight(estimate))
+}
+
+// epicScope formats the epic scope change with the added, removed and re-parented story counts
+func epicScope(pair *calculator.Pair) string {
+	if !pair.HasScopeChanges() {
+		return signedPercent(pair.ScopeChange())
+	}
+
+	return fmt.Sprintf("%s (+%d, -%d, ~%d)",
+		signedPercent(pair.ScopeChange()), len(pair.Added), len(pair.Removed), len(pair.Reparented))
+}
+
+// scopeChanges lists the stories which joined or left the epic
+func scopeChanges(pair *calculator.Pair) string {
+	changes := make([]string, 0, 3)
+	if len(pair.Added) > 0 {
+		changes = append(changes, "added "+storyKeys(pair.Added))
+	}
+
+	if len(pair.Removed) > 0 {
+		changes = append(changes, "removed "+storyKeys(pair.Removed))
+	}
+
+	for _, moved := range pair.Reparented {
+		if moved.To == pair.Key {
+			changes = append(changes, fmt.Sprintf("moved %s from %s", moved.Story.Key, moved.From))
+		} else {
+			changes = append(changes, fmt.Sprintf("moved %s to %s", moved.Story.Key, moved.To))
+		}
+	}
+
+	return strings.Join(changes, "; ")
+}
+
+func storyKeys(stories []*calculator.PlanStory) string {
+	keys := make([]string, 0, len(stories))
+	for _, story := range stories {
+		keys = append(keys, story.Key)
+	}
+
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,224 @@
+package format
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/makarski/roadsnap/calculator"
+)
+
+// ReportDoc is the JSON schema of a progress report.
+// The "from" and "to" prefixed values are taken from the snapshots at the period start and end.
+type ReportDoc struct {
+	SchemaVersion int    `json:"schema_version"`
+	Project       string `json:"project"`
+	// Granularity is one of: week, month, quarter, half-year
+	Granularity string         `json:"granularity"`
+	From        string         `json:"from"`
+	To          string         `json:"to"`
+	Periods     []ReportPeriod `json:"periods"`
+}
+
+// ReportPeriod is a single report period.
+// The durations are medians and 85th percentiles in days, 0 if no issue was done.
+type ReportPeriod struct {
+	Title               string       `json:"title"`
+	From                string       `json:"from"`
+	To                  string       `json:"to"`
+	SnapshotFrom        string       `json:"snapshot_from"`
+	SnapshotTo          string       `json:"snapshot_to"`
+	FromChangelog       bool         `json:"from_changelog"`
+	EpicsPlannedFrom    int          `json:"epics_planned_from"`
+	EpicsPlannedTo      int          `json:"epics_planned_to"`
+	EpicsDoneFrom       int          `json:"epics_done_from"`
+	EpicsDoneTo         int          `json:"epics_done_to"`
+	StoriesPlannedFrom  int          `json:"stories_planned_from"`
+	StoriesPlannedTo    int          `json:"stories_planned_to"`
+	StoriesDoneFrom     int          `json:"stories_done_from"`
+	StoriesDoneTo       int          `json:"stories_done_to"`
+	EstimateUnit        string       `json:"estimate_unit"`
+	EstimatePlannedFrom float64      `json:"estimate_planned_from"`
+	EstimatePlannedTo   float64      `json:"estimate_planned_to"`
+	EstimateDoneFrom    float64      `json:"estimate_done_from"`
+	EstimateDoneTo      float64      `json:"estimate_done_to"`
+	Progress            float64      `json:"progress"`
+	ScopeChange         float64      `json:"scope_change"`
+	CycleTimeMedianDays float64      `json:"cycle_time_median_days"`
+	CycleTimeP85Days    float64      `json:"cycle_time_p85_days"`
+	LeadTimeMedianDays  float64      `json:"lead_time_median_days"`
+	LeadTimeP85Days     float64      `json:"lead_time_p85_days"`
+	Epics               []ReportEpic `json:"epics"`
+}
+
+// ReportEpic is an epic paired between the period snapshots,
+// the values of the side the epic is missing from are empty
+type ReportEpic struct {
+	Key   string `json:"key"`
+	Title string `json:"title"`
+	Link  string `json:"link"`
+	// PlanningStatus is one of: Ok, Postponed, Advanced, Replanned
+	PlanningStatus string `json:"planning_status"`
+	// StatusFrom and StatusTo are the status categories: ToDo, InProgress, Done
+	StatusFrom          string  `json:"status_from"`
+	StatusTo            string  `json:"status_to"`
+	DueDateFrom         string  `json:"due_date_from"`
+	DueDateTo           string  `json:"due_date_to"`
+	StoriesFrom         int     `json:"stories_from"`
+	StoriesTo           int     `json:"stories_to"`
+	StoriesDoneFrom     int     `json:"stories_done_from"`
+	StoriesDoneTo       int     `json:"stories_done_to"`
+	EstimateFrom        float64 `json:"estimate_from"`
+	EstimateTo          float64 `json:"estimate_to"`
+	EstimateDoneFrom    float64 `json:"estimate_done_from"`
+	EstimateDoneTo      float64 `json:"estimate_done_to"`
+	Progress            float64 `json:"progress"`
+	ScopeChange         float64 `json:"scope_change"`
+	StoriesAdded        int     `json:"stories_added"`
+	StoriesRemoved      int     `json:"stories_removed"`
+	StoriesReparented   int     `json:"stories_reparented"`
+	CycleTimeMedianDays float64 `json:"cycle_time_median_days"`
+	CycleTimeP85Days    float64 `json:"cycle_time_p85_days"`
+	LeadTimeMedianDays  float64 `json:"lead_time_median_days"`
+	LeadTimeP85Days     float64 `json:"lead_time_p85_days"`
+}
+
+// ReportCSVHeader are the CSV columns of the report periods, one row per period
+var ReportCSVHeader = []string{
+	"project", "granularity", "period", "from", "to", "snapshot_from", "snapshot_to", "from_changelog",
+	"epics_planned_from", "epics_planned_to", "epics_done_from", "epics_done_to",
+	"stories_planned_from", "stories_planned_to", "stories_done_from", "stories_done_to",
+	"estimate_unit", "estimate_planned_from", "estimate_planned_to", "estimate_done_from", "estimate_done_to",
+	"progress", "scope_change",
+	"cycle_time_median_days", "cycle_time_p85_days", "lead_time_median_days", "lead_time_p85_days",
+}
+
+// ReportEpicsCSVHeader are the CSV columns of the report epic pairs, one row per epic and period
+var ReportEpicsCSVHeader = []string{
+	"project", "period", "key", "title", "link", "planning_status", "status_from", "status_to", "due_date_from", "due_date_to",
+	"stories_from", "stories_to", "stories_done_from", "stories_done_to",
+	"estimate_unit", "estimate_from", "estimate_to", "estimate_done_from", "estimate_done_to",
+	"progress", "scope_change", "stories_added", "stories_removed", "stories_reparented",
+	"cycle_time_median_days", "cycle_time_p85_days", "lead_time_median_days", "lead_time_p85_days",
+}
+
+func NewReportDoc(project string, granularity calculator.Granularity, reports []calculator.Report2) ReportDoc {
+	doc := ReportDoc{
+		SchemaVersion: SchemaVersion,
+		Project:       project,
+		Granularity:   string(granularity),
+		Periods:       make([]ReportPeriod, 0, len(reports)),
+	}
+
+	if len(reports) > 0 {
+		doc.From, doc.To = date(reports[0].From), date(reports[len(reports)-1].To)
+	}
+
+	for _, report := range reports {
+		period := ReportPeriod{
+			Title:               report.Title,
+			From:                date(report.From),
+			To:                  date(report.To),
+			SnapshotFrom:        date(report.SnapshotFrom),
+			SnapshotTo:          date(report.SnapshotTo),
+			FromChangelog:       report.FromChangelog,
+			EpicsPlannedFrom:    report.LeftEpicsPlanned,
+			EpicsPlannedTo:      report.RightEpicsPlanned,
+			EpicsDoneFrom:       report.LeftEpicsDone,
+			EpicsDoneTo:         report.RightEpicsDone,
+			StoriesPlannedFrom:  report.LeftStoriesPlanned,
+			StoriesPlannedTo:    report.RightStoriesPlanned,
+			StoriesDoneFrom:     report.LeftStoriesDone,
+			StoriesDoneTo:       report.RightStoriesDone,
+			EstimateUnit:        unit(report.Estimator),
+			EstimatePlannedFrom: round(report.LeftEstimatePlanned),
+			EstimatePlannedTo:   round(report.RightEstimatePlanned),
+			EstimateDoneFrom:    round(report.LeftEstimateDone),
+			EstimateDoneTo:      round(report.RightEstimateDone),
+			Progress:            round(report.Progress()),
+			ScopeChange:         round(report.ScopeChange()),
+			CycleTimeMedianDays: days(report.Flow.CycleTime.Median),
+			CycleTimeP85Days:    days(report.Flow.CycleTime.P85),
+			LeadTimeMedianDays:  days(report.Flow.LeadTime.Median),
+			LeadTimeP85Days:     days(report.Flow.LeadTime.P85),
+			Epics:               make([]ReportEpic, 0, len(report.EpicPairs)),
+		}
+
+		for _, pair := range report.EpicPairs {
+			period.Epics = append(period.Epics, newReportEpic(pair))
+		}
+
+		doc.Periods = append(doc.Periods, period)
+	}
+
+	return doc
+}
+
+func newReportEpic(pair *calculator.Pair) ReportEpic {
+	return ReportEpic{
+		Key:                 pair.Key,
+		Title:               pair.Title,
+		Link:                pair.Link,
+		PlanningStatus:      string(pair.PlanningStatus()),
+		StatusFrom:          string(pair.Left.Status),
+		StatusTo:            string(pair.Right.Status),
+		DueDateFrom:         date(pair.Left.DueDate),
+		DueDateTo:           date(pair.Right.DueDate),
+		StoriesFrom:         len(pair.Left.PlanStories),
+		StoriesTo:           len(pair.Right.PlanStories),
+		StoriesDoneFrom:     pair.Left.StoriesDone,
+		StoriesDoneTo:       pair.Right.StoriesDone,
+		EstimateFrom:        round(pair.Left.Estimate),
+		EstimateTo:          round(pair.Right.Estimate),
+		EstimateDoneFrom:    round(pair.Left.EstimateDone),
+		EstimateDoneTo:      round(pair.Right.EstimateDone),
+		Progress:            round(pair.Progress()),
+		ScopeChange:         round(pair.ScopeChange()),
+		StoriesAdded:        len(pair.Added),
+		StoriesRemoved:      len(pair.Removed),
+		StoriesReparented:   len(pair.Reparented),
+		CycleTimeMedianDays: days(pair.Right.Flow.CycleTime.Median),
+		CycleTimeP85Days:    days(pair.Right.Flow.CycleTime.P85),
+		LeadTimeMedianDays:  days(pair.Right.Flow.LeadTime.Median),
+		LeadTimeP85Days:     days(pair.Right.Flow.LeadTime.P85),
+	}
+}
+
+// WriteReport writes the report as JSON, or the report periods as CSV
+func WriteReport(w io.Writer, f Format, doc ReportDoc) error {
+	if f == JSON {
+		return writeJSON(w, doc)
+	}
+
+	rows := make([][]string, 0, len(doc.Periods))
+	for _, p := range doc.Periods {
+		rows = append(rows, []string{
+			doc.Project, doc.Granularity, p.Title, p.From, p.To, p.SnapshotFrom, p.SnapshotTo, strconv.FormatBool(p.FromChangelog),
+			strconv.Itoa(p.EpicsPlannedFrom), strconv.Itoa(p.EpicsPlannedTo), strconv.Itoa(p.EpicsDoneFrom), strconv.Itoa(p.EpicsDoneTo),
+			strconv.Itoa(p.StoriesPlannedFrom), strconv.Itoa(p.StoriesPlannedTo), strconv.Itoa(p.StoriesDoneFrom), strconv.Itoa(p.StoriesDoneTo),
+			p.EstimateUnit, num(p.EstimatePlannedFrom), num(p.EstimatePlannedTo), num(p.EstimateDoneFrom), num(p.EstimateDoneTo),
+			num(p.Progress), num(p.ScopeChange),
+			num(p.CycleTimeMedianDays), num(p.CycleTimeP85Days), num(p.LeadTimeMedianDays), num(p.LeadTimeP85Days),
+		})
+	}
+
+	return writeCSV(w, ReportCSVHeader, rows)
+}
+
+// WriteReportEpics writes the epic pairs of all the report periods as CSV
+func WriteReportEpics(w io.Writer, doc ReportDoc) error {
+	rows := make([][]string, 0)
+
+	for _, p := range doc.Periods {
+		for _, e := range p.Epics {
+			rows = append(rows, []string{
+				doc.Project, p.Title, e.Key, e.Title, e.Link, e.PlanningStatus, e.StatusFrom, e.StatusTo, e.DueDateFrom, e.DueDateTo,
+				strconv.Itoa(e.StoriesFrom), strconv.Itoa(e.StoriesTo), strconv.Itoa(e.StoriesDoneFrom), strconv.Itoa(e.StoriesDoneTo),
+				p.EstimateUnit, num(e.EstimateFrom), num(e.EstimateTo), num(e.EstimateDoneFrom), num(e.EstimateDoneTo),
+				num(e.Progress), num(e.ScopeChange), strconv.Itoa(e.StoriesAdded), strconv.Itoa(e.StoriesRemoved), strconv.Itoa(e.StoriesReparented),
+				num(e.CycleTimeMedianDays), num(e.CycleTimeP85Days), num(e.LeadTimeMedianDays), num(e.LeadTimeP85Days),
+			})
+		}
+	}
+
+	return writeCSV(w, ReportEpicsCSVHeader, rows)
+}
@@ -0,0 +1,116 @@
+package format
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/makarski/roadsnap/calculator"
+)
+
+// SummaryDoc is the JSON schema of a snapshot summary
+type SummaryDoc struct {
+	SchemaVersion int    `json:"schema_version"`
+	Project       string `json:"project"`
+	Date          string `json:"date"`
+	// EstimateUnit is "count", "pts" or "h"
+	EstimateUnit string        `json:"estimate_unit"`
+	Epics        []SummaryEpic `json:"epics"`
+}
+
+// SummaryEpic is a summary epic, the dates are formatted as YYYY-MM-DD and empty if not set
+type SummaryEpic struct {
+	Key   string `json:"key"`
+	Title string `json:"title"`
+	Link  string `json:"link"`
+	// Category is one of: Done, Ongoing, Overdue, To Do
+	Category          string   `json:"category"`
+	Status            string   `json:"status"`
+	Labels            []string `json:"labels"`
+	StartDate         string   `json:"start_date"`
+	DueDate           string   `json:"due_date"`
+	Quarter           string   `json:"quarter"`
+	StoriesTotal      int      `json:"stories_total"`
+	StoriesDone       int      `json:"stories_done"`
+	StoriesInProgress int      `json:"stories_in_progress"`
+	StoriesToDo       int      `json:"stories_todo"`
+	EstimateTotal     float64  `json:"estimate_total"`
+	EstimateDone      float64  `json:"estimate_done"`
+	Progress          float64  `json:"progress"`
+}
+
+// SummaryCSVHeader are the CSV columns of a summary, one row per epic, the labels are joined by ";"
+var SummaryCSVHeader = []string{
+	"project", "date", "key", "title", "link", "category", "status", "labels", "start_date", "due_date", "quarter",
+	"stories_total", "stories_done", "stories_in_progress", "stories_todo",
+	"estimate_unit", "estimate_total", "estimate_done", "progress",
+}
+
+func NewSummaryDoc(summary *calculator.Summary) SummaryDoc {
+	doc := SummaryDoc{
+		SchemaVersion: SchemaVersion,
+		Project:       summary.Project,
+		Date:          date(summary.Date),
+		EstimateUnit:  unit(summary.Estimator()),
+		Epics:         make([]SummaryEpic, 0, summary.AllCount()),
+	}
+
+	for _, stats := range summary.Epics() {
+		epic := stats.Epic.Epic
+
+		labels := make([]string, 0)
+		status := ""
+		title := ""
+		if epic.Fields != nil {
+			labels = append(labels, epic.Fields.Labels...)
+			title = epic.Fields.Summary
+
+			if epic.Fields.Status != nil {
+				status = epic.Fields.Status.Name
+			}
+		}
+
+		doc.Epics = append(doc.Epics, SummaryEpic{
+			Key:               epic.Key,
+			Title:             title,
+			Link:              stats.Link,
+			Category:          stats.Category,
+			Status:            status,
+			Labels:            labels,
+			StartDate:         date(stats.Epic.StartDate),
+			DueDate:           date(stats.Epic.DueDate),
+			Quarter:           stats.Quarter,
+			StoriesTotal:      stats.StoriesTotal,
+			StoriesDone:       stats.StoriesDone,
+			StoriesInProgress: stats.StoriesInProgress,
+			StoriesToDo:       stats.StoriesToDo,
+			EstimateTotal:     round(stats.Estimate),
+			EstimateDone:      round(stats.EstimateDone),
+			Progress:          round(stats.Progress),
+		})
+	}
+
+	return doc
+}
+
+// WriteSummary writes the summary as JSON, CSV or HTML
+func WriteSummary(w io.Writer, f Format, doc SummaryDoc) error {
+	switch f {
+	case JSON:
+		return writeJSON(w, doc)
+	case HTML:
+		return WriteSummaryHTML(w, doc)
+	}
+
+	rows := make([][]string, 0, len(doc.Epics))
+	for _, e := range doc.Epics {
+		rows = append(rows, []string{
+			doc.Project, doc.Date, e.Key, e.Title, e.Link, e.Category, e.Status, strings.Join(e.Labels, ";"),
+			e.StartDate, e.DueDate, e.Quarter,
+			strconv.Itoa(e.StoriesTotal), strconv.Itoa(e.StoriesDone), strconv.Itoa(e.StoriesInProgress), strconv.Itoa(e.StoriesToDo),
+			doc.EstimateUnit, num(e.EstimateTotal), num(e.EstimateDone), num(e.Progress),
+		})
+	}
+
+	return writeCSV(w, SummaryCSVHeader, rows)
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/makarski/roadsnap/calculator"
+	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/config"
+)
+
+func historyFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("history", flag.ExitOnError)
+	fls.StringVar(&HistoryArgs.Project, "project", "", "Show only the given project")
+	fls.StringVar(&HistoryArgs.Epic, "epic", "", "Show only the given epic key")
+	fls.BoolVar(&HistoryArgs.All, "all", false, "Show the epics whose due date never changed")
+	fls.BoolVar(&HistoryArgs.Chronic, "chronic", false, "Show only the chronically slipping epics")
+
+	return fls
+}
+
+// historyCmd prints the due date changes of the epics across all the snapshots
+func historyCmd(cfg *config.Config) CmdFunc {
+	statusConverter := calculator.NewStatusConverter(cfg.StatusNames)
+
+	return func() error {
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		differ := calculator.NewTimeWindowDiffer(cfg.JiraCrd.BaseURL+"browse", statusConverter, calculator.Estimator{}, store)
+
+		projects, err := cache.ListSnapshotDates(store, HistoryArgs.Project)
+		if err != nil {
+			return err
+		}
+
+		for _, project := range projects {
+			histories, err := differ.SlipHistory(project.Project)
+			if err != nil {
+				return fmt.Errorf("failed to build due date history for project: %s. %s", project.Project, err)
+			}
+
+			fmt.Fprintf(out, "> Project: %s\n", project.Project)
+
+			for _, history := range histories {
+				if HistoryArgs.Epic != "" && history.Key != HistoryArgs.Epic ||
+					!HistoryArgs.All && len(history.Changes) == 0 ||
+					HistoryArgs.Chronic && !history.Chronic() {
+					continue
+				}
+
+				chronic := ""
+				if history.Chronic() {
+					chronic = " [chronic]"
+				}
+
+				fmt.Fprintf(out, "  * %s %s: due %s, %d reschedule(s), cumulative slip %s%s\n",
+					history.Key, history.Title, formatDueDate(history.Current),
+					history.Reschedules(), formatSlipDays(history.CumulativeSlip()), chronic)
+
+				for _, change := range history.Changes {
+					fmt.Fprintf(out, "    - %s\n", formatDueDateChange(change))
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+func formatDueDateChange(change calculator.DueDateChange) string {
+	return fmt.Sprintf("%s: %s -> %s (%s)",
+		change.ObservedAt.Format(viewDateFormat),
+		formatDueDate(change.From),
+		formatDueDate(change.To),
+		formatSlipDays(change.Days()),
+	)
+}
+
+func formatDueDate(t time.Time) string {
+	if t.IsZero() {
+		return "not set"
+	}
+
+	return t.Format(viewDateFormat)
+}
+
+func formatSlipDays(days int) string {
+	return fmt.Sprintf("%+d days", days)
+}
@@ -2,33 +2,42 @@ package list
 
 import (
 	"fmt"
-	"os"
 	"path"
+	"text/template"
 	"time"
 
 	"github.com/makarski/roadsnap/calculator"
 	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/cmd/format"
+	"github.com/makarski/roadsnap/util"
 )
 
-type (
-	CacheReader interface {
-		FromCacheOrdered(time.Time, string) ([]*cache.EpicLink, error)
-	}
-
-	SummaryGenerator interface {
-		GenerateSummary([]*cache.EpicLink, string, time.Time) calculator.Summary
-	}
-)
+type SummaryGenerator interface {
+	GenerateSummary([]*cache.EpicLink, string, time.Time) calculator.Summary
+}
 
 // todo: deprecate this
 type Lister struct {
-	cr        CacheReader
+	store     cache.Store
 	sg        SummaryGenerator
 	targetDir string
+	format    format.Format
+	template  *template.Template
+}
+
+func NewLister(store cache.Store, sg SummaryGenerator, targetDir string) *Lister {
+	tmpl := template.Must(format.LoadTemplate("list", "", format.DefaultSummaryTemplate))
+	return &Lister{store, sg, targetDir, format.Markdown, tmpl}
 }
 
-func NewLister(cr CacheReader, sg SummaryGenerator, targetDir string) *Lister {
-	return &Lister{cr, sg, targetDir}
+// SetFormat sets the report file format, markdown by default
+func (l *Lister) SetFormat(f format.Format) {
+	l.format = f
+}
+
+// SetTemplate sets the markdown summary template, the built-in one by default
+func (l *Lister) SetTemplate(tmpl *template.Template) {
+	l.template = tmpl
 }
 
 func (l *Lister) WriteReport(date time.Time, project string) error {
@@ -37,21 +46,24 @@ func (l *Lister) WriteReport(date time.Time, project string) error {
 		return err
 	}
 
-	reportTxt := summary.String()
-	fileKey := path.Join(l.targetDir, project, date.Format(cache.DateFormat), project+"_roadsnap.md")
+	fileKey := path.Join(l.targetDir, project, date.Format(cache.DateFormat), project+"_roadsnap"+l.format.Ext())
 
-	f, err := os.Create(fileKey)
-	defer f.Close()
+	// the snapshot dir does not exist for the non-fs storage backends
+	f, err := util.CreateFile(fileKey)
 	if err != nil {
 		return fmt.Errorf("failed to created report file: %s. %s", fileKey, err)
 	}
+	defer f.Close()
+
+	if l.format != format.Markdown {
+		return format.WriteSummary(f, l.format, format.NewSummaryDoc(&summary))
+	}
 
-	_, err = f.WriteString(reportTxt)
-	return err
+	return format.WriteSummaryMarkdown(f, l.template, &summary)
 }
 
 func (l *Lister) GenerateSummary(date time.Time, project string) (calculator.Summary, error) {
-	epics, err := l.cr.FromCacheOrdered(date, project)
+	epics, err := cache.FromCacheOrdered(l.store, date, project)
 	if err != nil {
 		return calculator.Summary{}, err
 	}
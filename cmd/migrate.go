@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/config"
+)
+
+func migrateFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fls.BoolVar(&MigrateArgs.DryRun, "dry-run", false, "Print the changes without applying them")
+
+	return fls
+}
+
+// migrateCmd upgrades the cached snapshots to the current storage layout in place
+func migrateCmd(cfg *config.Config) CmdFunc {
+	return func() error {
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		migrator, ok := store.(cache.LayoutMigrator)
+		if !ok {
+			fmt.Fprintf(out, "> Storage backend `%s` has no layout to migrate\n", cfg.Storage.Backend)
+			return nil
+		}
+
+		changes, err := migrator.MigrateLayout(MigrateArgs.DryRun)
+		if err != nil {
+			return err
+		}
+
+		if len(changes) == 0 {
+			fmt.Fprintln(out, "> Cache layout is up to date")
+			return nil
+		}
+
+		if MigrateArgs.DryRun {
+			fmt.Fprintln(out, "> Changes to be applied:")
+		} else {
+			fmt.Fprintln(out, "> Applied changes:")
+		}
+
+		for _, change := range changes {
+			fmt.Fprintf(out, "  * %s\n", change)
+		}
+
+		return nil
+	}
+}
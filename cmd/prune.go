@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/makarski/roadsnap/calculator"
+	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/cmd/format"
+	"github.com/makarski/roadsnap/config"
+	"github.com/makarski/roadsnap/util"
+)
+
+func pruneFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("prune", flag.ExitOnError)
+	fls.BoolVar(&PruneArgs.DryRun, "dry-run", false, "Print the snapshots to be removed without removing them")
+	fls.StringVar(&PruneArgs.Project, "project", "", "Prune only the given project")
+	fls.IntVar(&PruneArgs.DailyDays, "daily", 0, "Keep all snapshots for the number of days. Overrides retention.daily_days")
+	fls.IntVar(&PruneArgs.WeeklyWeeks, "weekly", 0, "Keep weekly snapshots for the number of weeks. Overrides retention.weekly_weeks")
+	fls.IntVar(&PruneArgs.MonthlyMonths, "monthly", -1, "Keep monthly snapshots for the number of months, 0 - forever. Overrides retention.monthly_months")
+
+	return fls
+}
+
+// pruneCmd removes the snapshots which are not retained by the retention policy.
+// Snapshots used by the existing reports are never removed.
+func pruneCmd(cfg *config.Config) CmdFunc {
+	return func() error {
+		retentionCfg := *cfg.Retention
+		if PruneArgs.DailyDays > 0 {
+			retentionCfg.DailyDays = PruneArgs.DailyDays
+		}
+		if PruneArgs.WeeklyWeeks > 0 {
+			retentionCfg.WeeklyWeeks = PruneArgs.WeeklyWeeks
+		}
+		if PruneArgs.MonthlyMonths >= 0 {
+			retentionCfg.MonthlyMonths = PruneArgs.MonthlyMonths
+		}
+
+		policy := cache.NewRetentionPolicy(&retentionCfg)
+
+		calendar, err := calculator.NewCalendar(cfg.Report.FiscalYearStart)
+		if err != nil {
+			return err
+		}
+
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		projects, err := cache.ListSnapshotDates(store, PruneArgs.Project)
+		if err != nil {
+			return err
+		}
+
+		removed := 0
+
+		for _, project := range projects {
+			_, candidates, err := policy.Select(project.Dates, time.Now())
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(out, "> Pruning project: %s\n", project.Project)
+
+			protected, err := reportSnapshotDates(project.Project, project.Dates, calendar)
+			if err != nil {
+				return err
+			}
+
+			for _, date := range candidates {
+				if protected[date] {
+					fmt.Fprintf(out, "  * %s: kept, used by a report\n", date)
+					continue
+				}
+
+				if PruneArgs.DryRun {
+					fmt.Fprintf(out, "  * %s: would be removed\n", date)
+					continue
+				}
+
+				t, err := time.Parse(dateFormat, date)
+				if err != nil {
+					return fmt.Errorf("failed to parse time for project: %s:%s. %s", project.Project, date, err)
+				}
+
+				if err := store.Delete(project.Project, t); err != nil {
+					return err
+				}
+
+				removed++
+				fmt.Fprintf(out, "  * %s: removed\n", date)
+			}
+
+			if gc, ok := store.(cache.GarbageCollector); ok && !PruneArgs.DryRun {
+				objects, err := gc.GC(project.Project)
+				if err != nil {
+					return err
+				}
+
+				if objects > 0 {
+					fmt.Fprintf(out, "  * removed %d unreferenced object(s)\n", objects)
+				}
+			}
+		}
+
+		if !PruneArgs.DryRun {
+			fmt.Fprintf(out, "> Removed %d snapshot(s)\n", removed)
+		}
+
+		return nil
+	}
+}
+
+// reportSnapshotDates returns the snapshot dates the existing reports of the project are built from.
+// The windows of the reports written without the windows file are rebuilt from the report period,
+// all the snapshots within a window and the first one after it are kept.
+func reportSnapshotDates(project string, dates []string, calendar calculator.Calendar) (map[string]bool, error) {
+	projectKey := util.RemoveSpaces(project)
+
+	reports, err := filepath.Glob(path.Join(InArgs.Dir, projectKey, projectKey+"-*"))
+	if err != nil {
+		return nil, err
+	}
+
+	protected := make(map[string]bool)
+	periods := make(map[string]bool)
+
+	for _, report := range reports {
+		period, ok := reportPeriod(path.Base(report), projectKey)
+		if !ok || periods[period] {
+			continue
+		}
+		periods[period] = true
+
+		windows, err := readReportWindows(generateFileName(projectKey, period, reportWindowsExt))
+		if err == nil {
+			for _, window := range windows.Windows {
+				protected[window.SnapshotFrom] = true
+				protected[window.SnapshotTo] = true
+
+				for _, date := range window.Snapshots {
+					protected[date] = true
+				}
+			}
+			continue
+		}
+
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		windowsByPeriod, err := periodWindows(period, calendar)
+		if err != nil {
+			fmt.Fprintf(out, "  * %s: unknown report period, its snapshots are not protected. %s\n", path.Base(report), err)
+			continue
+		}
+
+		for _, window := range windowsByPeriod {
+			from, to, err := calculator.FindSnapshotDatesForPeriod(dates, window.From, window.To)
+			if err != nil {
+				return nil, err
+			}
+
+			protected[from.Format(dateFormat)] = true
+			protected[to.Format(dateFormat)] = true
+
+			// the period end may be rewound from the first snapshot after the window
+			windowFrom, windowTo := window.From.Format(dateFormat), window.To.Format(dateFormat)
+			for _, date := range dates {
+				if date >= windowFrom {
+					protected[date] = true
+				}
+
+				if date > windowTo {
+					break
+				}
+			}
+		}
+	}
+
+	return protected, nil
+}
+
+// reportPeriod returns the period of a report file of any format, the csv epics are written to "<period>-epics.csv"
+func reportPeriod(filename, projectKey string) (string, bool) {
+	if strings.HasSuffix(filename, reportWindowsExt) {
+		return "", false
+	}
+
+	ext := path.Ext(filename)
+	switch ext {
+	case format.Markdown.Ext(), format.JSON.Ext(), format.CSV.Ext(), format.HTML.Ext():
+	default:
+		return "", false
+	}
+
+	period := strings.TrimSuffix(strings.TrimPrefix(filename, projectKey+"-"), ext)
+	if ext == format.CSV.Ext() {
+		period = strings.TrimSuffix(period, "-epics")
+	}
+
+	return period, true
+}
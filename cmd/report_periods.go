@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/makarski/roadsnap/calculator"
+	"github.com/makarski/roadsnap/cmd/format"
+)
+
+// reportWindowsExt is the extension of the file the report windows are written to, next to the report files
+const reportWindowsExt = ".windows.json"
+
+// reportWindows are the periods of a report and the snapshots they were built from, prune keeps these snapshots
+type reportWindows struct {
+	Granularity string         `json:"granularity"`
+	From        string         `json:"from"`
+	To          string         `json:"to"`
+	Windows     []reportWindow `json:"windows"`
+}
+
+type reportWindow struct {
+	Title        string `json:"title"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	SnapshotFrom string `json:"snapshot_from"`
+	SnapshotTo   string `json:"snapshot_to"`
+	// Snapshots are all the snapshots the window is read from, the boundary snapshots included
+	Snapshots []string `json:"snapshots,omitempty"`
+}
+
+func writeReportWindows(period string, data format.ReportData) error {
+	windows := reportWindows{
+		Granularity: string(data.Granularity),
+		From:        data.From.Format(dateFormat),
+		To:          data.To.Format(dateFormat),
+		Windows:     make([]reportWindow, 0, len(data.Reports)),
+	}
+
+	for _, report := range data.Reports {
+		snapshots := make([]string, 0, len(report.Snapshots))
+		for _, date := range report.Snapshots {
+			snapshots = append(snapshots, date.Format(dateFormat))
+		}
+
+		windows.Windows = append(windows.Windows, reportWindow{
+			Title:        report.Title,
+			From:         report.From.Format(dateFormat),
+			To:           report.To.Format(dateFormat),
+			SnapshotFrom: report.SnapshotFrom.Format(dateFormat),
+			SnapshotTo:   report.SnapshotTo.Format(dateFormat),
+			Snapshots:    snapshots,
+		})
+	}
+
+	return writeFile(generateFileName(data.Project, period, reportWindowsExt), func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(windows)
+	})
+}
+
+func readReportWindows(filename string) (*reportWindows, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var windows reportWindows
+	if err := json.Unmarshal(b, &windows); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal report windows: %s. %s", filename, err)
+	}
+
+	return &windows, nil
+}
+
+// periodWindows rebuilds the windows of a report written without the windows file from its period,
+// ex: "2026", "FY2026-quarter", "2026-03-01_2026-04-15-week".
+// Plain years are calendar years, the reports of the fiscal years are named "FY".
+func periodWindows(period string, calendar calculator.Calendar) ([]calculator.ReportWindow, error) {
+	granularity := calculator.GranularityMonth
+	for _, g := range []calculator.Granularity{calculator.GranularityWeek, calculator.GranularityQuarter, calculator.GranularityHalfYear} {
+		if strings.HasSuffix(period, "-"+string(g)) {
+			granularity, period = g, strings.TrimSuffix(period, "-"+string(g))
+			break
+		}
+	}
+
+	if dates := strings.Split(period, "_"); len(dates) == 2 {
+		from, err := time.Parse(dateFormat, dates[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid report period: %s. %s", period, err)
+		}
+
+		to, err := time.Parse(dateFormat, dates[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid report period: %s. %s", period, err)
+		}
+
+		return calendar.Windows(from, to, granularity), nil
+	}
+
+	if !strings.HasPrefix(period, "FY") {
+		calendar = calculator.Calendar{}
+	}
+
+	year, err := strconv.Atoi(strings.TrimPrefix(period, "FY"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid report period: %s. %s", period, err)
+	}
+
+	from := calendar.YearStart(year)
+
+	return calendar.Windows(from, calendar.YearStart(year+1).AddDate(0, 0, -1), granularity), nil
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/config"
+)
+
+const (
+	storageBackendFS     = "fs"
+	storageBackendSQLite = "sqlite"
+
+	defaultSQLiteFile = "roadsnap.db"
+)
+
+// newStore returns the snapshot store configured by the storage backend
+func newStore(cfg *config.Config) (cache.Store, error) {
+	switch cfg.Storage.Backend {
+	case "", storageBackendFS:
+		compression, err := cache.ParseCompression(cfg.Storage.Compression)
+		if err != nil {
+			return nil, err
+		}
+
+		store := cache.NewFSStore(InArgs.Dir)
+		store.SetOptions(cache.FSOptions{Compression: compression, Dedup: cfg.Storage.Dedup})
+
+		return store, nil
+	case storageBackendSQLite:
+		return cache.NewSQLiteStore(sqlitePath(cfg.Storage))
+	}
+
+	return nil, fmt.Errorf("unsupported storage backend: %s", cfg.Storage.Backend)
+}
+
+// sqlitePath returns the database file path, relative paths are resolved against the work dir
+func sqlitePath(cfg *config.Storage) string {
+	if cfg.Path == "" {
+		return path.Join(InArgs.Dir, defaultSQLiteFile)
+	}
+
+	if path.IsAbs(cfg.Path) {
+		return cfg.Path
+	}
+
+	return path.Join(InArgs.Dir, cfg.Path)
+}
+
+func migrateStoreFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("migrate-store", flag.ExitOnError)
+	fls.StringVar(&MigrateStoreArgs.FromDir, "from-dir", "", "Directory with the */*/raw_data snapshot trees. Defaults to the work dir")
+	fls.BoolVar(&MigrateStoreArgs.Overwrite, "overwrite", false, "Replace the snapshots which already exist in the target store")
+
+	return fls
+}
+
+// migrateStoreCmd imports the file system snapshots into the configured storage backend
+func migrateStoreCmd(cfg *config.Config) CmdFunc {
+	return func() error {
+		fromDir := MigrateStoreArgs.FromDir
+		if fromDir == "" {
+			fromDir = InArgs.Dir
+		}
+
+		if cfg.Storage.Backend == "" || cfg.Storage.Backend == storageBackendFS {
+			return fmt.Errorf("storage backend is `%s`, configure the target backend in the [storage] section", storageBackendFS)
+		}
+
+		target, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer target.Close()
+
+		source := cache.NewFSStore(fromDir)
+
+		projects, err := cache.ListSnapshotDates(source, "")
+		if err != nil {
+			return err
+		}
+
+		imported, skipped := 0, 0
+
+		for _, project := range projects {
+			existing, err := target.ListDates(project.Project)
+			if err != nil {
+				return err
+			}
+
+			for _, date := range project.Dates {
+				if !MigrateStoreArgs.Overwrite && sliceContains(existing, date) {
+					fmt.Fprintf(out, "> Skipping %s %s - already stored\n", project.Project, date)
+					skipped++
+					continue
+				}
+
+				t, err := time.Parse(dateFormat, date)
+				if err != nil {
+					return fmt.Errorf("failed to parse time for project: %s:%s. %s", project.Project, date, err)
+				}
+
+				snapshot, err := source.Get(project.Project, t)
+				if err != nil {
+					return fmt.Errorf("failed to read snapshot: %s %s. %s", project.Project, date, err)
+				}
+
+				if err := target.Put(snapshot); err != nil {
+					return fmt.Errorf("failed to store snapshot: %s %s. %s", project.Project, date, err)
+				}
+
+				fmt.Fprintf(out, "> Imported %s %s\n", project.Project, date)
+				imported++
+			}
+		}
+
+		fmt.Fprintf(out, "> Imported %d snapshot(s), skipped %d\n", imported, skipped)
+
+		return nil
+	}
+}
+
+func sliceContains(s []string, v string) bool {
+	for _, item := range s {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
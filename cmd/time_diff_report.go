@@ -1,134 +1,241 @@
 package cmd
 
 import (
-	"bytes"
+	"flag"
 	"fmt"
+	"io"
+	"text/template"
 	"time"
 
 	"github.com/makarski/roadsnap/calculator"
 	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/cmd/format"
 	"github.com/makarski/roadsnap/config"
 	"github.com/makarski/roadsnap/util"
 )
 
 const viewDateFormat = "Jan 2, 2006"
 
+func reportFlagSet() *flag.FlagSet {
+	fls := flag.NewFlagSet("report", flag.ExitOnError)
+	fls.IntVar(&ReportArgs.Year, "year", 0, "Report the given (fiscal) year. Defaults to the current one")
+	fls.StringVar(&ReportArgs.Granularity, "granularity", string(calculator.GranularityMonth), "Report period: week, month, quarter, half-year")
+	fls.StringVar(&ReportArgs.From, "from", "", "Report from the given date (YYYY-MM-DD) instead of a whole year")
+	fls.StringVar(&ReportArgs.To, "to", "", "Report until the given date (YYYY-MM-DD) instead of a whole year")
+	fls.StringVar(&ReportArgs.Format, "format", string(format.Markdown), "Report file format: markdown, json, csv, html")
+	fls.StringVar(&ReportArgs.Template, "template", "", "Markdown report template file. Overrides templates.report")
+
+	return fls
+}
+
+// reportRange returns the reported dates and the report file name suffix.
+// Explicit dates take precedence over the year, a missing one defaults to today or the fiscal year start.
+func reportRange(calendar calculator.Calendar, now time.Time) (time.Time, time.Time, string, error) {
+	from, err := parseDateArg("from", ReportArgs.From)
+	if err != nil {
+		return from, from, "", err
+	}
+
+	to, err := parseDateArg("to", ReportArgs.To)
+	if err != nil {
+		return from, to, "", err
+	}
+
+	if from.IsZero() && to.IsZero() {
+		year := ReportArgs.Year
+		if year == 0 {
+			year = calendar.Year(now)
+		}
+
+		from = calendar.YearStart(year)
+		return from, calendar.YearStart(year+1).AddDate(0, 0, -1), calendar.YearName(year), nil
+	}
+
+	if ReportArgs.Year != 0 {
+		return from, to, "", fmt.Errorf("-year and -from/-to are mutually exclusive")
+	}
+
+	if to.IsZero() {
+		to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	if from.IsZero() {
+		from = calendar.YearStart(calendar.Year(to))
+	}
+
+	if to.Before(from) {
+		return from, to, "", fmt.Errorf("-to date %s is before -from date %s", to.Format(dateFormat), from.Format(dateFormat))
+	}
+
+	return from, to, from.Format(dateFormat) + "_" + to.Format(dateFormat), nil
+}
+
 func TimeWindowReport(cfg *config.Config) CmdFunc {
 	statusConverter := calculator.NewStatusConverter(cfg.StatusNames)
-	epicFinder := cache.NewEpicCacher(nil, InArgs.Dir)
-	differ := calculator.NewTimeWindowDiffer(cfg.JiraCrd.BaseURL+"browse", statusConverter, epicFinder, InArgs.Dir)
 
 	return func() error {
-		year := time.Now().Year()
+		estimator, err := calculator.NewEstimator(cfg.Estimate)
+		if err != nil {
+			return err
+		}
+
+		calendar, err := calculator.NewCalendar(cfg.Report.FiscalYearStart)
+		if err != nil {
+			return err
+		}
+
+		granularity, err := calculator.ParseGranularity(ReportArgs.Granularity)
+		if err != nil {
+			return err
+		}
+
+		outFormat, err := format.Parse(ReportArgs.Format)
+		if err != nil {
+			return err
+		}
+
+		tmpl, err := format.LoadTemplate("report", templatePath(ReportArgs.Template, cfg.Templates.Report), format.DefaultReportTemplate)
+		if err != nil {
+			return err
+		}
+
+		from, to, period, err := reportRange(calendar, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if granularity != calculator.GranularityMonth {
+			period += "-" + string(granularity)
+		}
+
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		linkPrefix := cfg.JiraCrd.BaseURL + "browse"
+		differ := calculator.NewTimeWindowDiffer(linkPrefix, statusConverter, estimator, store)
+		windows := calendar.Windows(from, to, granularity)
 
-		for _, project := range cfg.Projects.Names {
-			reports := make([]calculator.Report2, 0, 12)
+		for _, project := range cfg.Projects.ListNames() {
+			reports := make([]calculator.Report2, 0, len(windows))
 
-			for i := 1; i <= 12; i++ {
-				monthStart := time.Date(year, time.Month(i), 1, 0, 0, 0, 0, time.UTC)
-				monthEnd := monthStart.AddDate(0, 1, -1)
+			projectEstimator, err := windowsEstimator(store, estimator, project, windows)
+			if err != nil {
+				return fmt.Errorf("failed to build reports: %s", err)
+			}
+			differ.SetEstimator(projectEstimator)
 
-				fmt.Println("> Generating report for", project, monthStart.Format("Jan, 2006"))
+			for _, window := range windows {
+				fmt.Println("> Generating report for", project, window.Title)
 
-				report, err := differ.Report(project, monthStart, monthEnd)
+				report, err := differ.Report(project, window.From, window.To)
 				if err != nil {
 					return fmt.Errorf("failed to build reports: %s", err)
 				}
 
+				report.Title = window.Title
 				reports = append(reports, *report)
 			}
 
-			filename := generateFileName(project, year)
-			f, err := util.CreateFile(filename)
+			histories, err := differ.SlipHistory(project)
 			if err != nil {
+				return fmt.Errorf("failed to build due date history: %s", err)
+			}
+
+			data := format.ReportData{Project: project, Granularity: granularity, From: from, To: to, Reports: reports, Histories: histories}
+			if err := writeReport(period, outFormat, tmpl, data, linkPrefix); err != nil {
 				return err
 			}
 
-			fmt.Fprint(f, ToMarkdown(project, reports))
-			f.Close()
+			if err := writeReportWindows(period, data); err != nil {
+				return err
+			}
 		}
 		return nil
 	}
 }
 
-// generateFileName returns a file name for the report
-func generateFileName(project string, year int) string {
-	project = util.RemoveSpaces(project)
-	return fmt.Sprintf("%s/%s/%s-%d.md", InArgs.Dir, project, project, year)
-}
+// windowsEstimator decides the estimate unit once for the snapshots of all the report windows,
+// the first snapshots after the windows included, the period end states may be read from them
+func windowsEstimator(store cache.Store, estimator calculator.Estimator, project string, windows []calculator.ReportWindow) (calculator.Estimator, error) {
+	entries, err := cache.ListSnapshotDates(store, project)
+	if err != nil || len(entries) == 0 {
+		return estimator, err
+	}
 
-func ToMarkdown(project string, reports []calculator.Report2) string {
-	var overview, details bytes.Buffer
-
-	overview.WriteString(fmt.Sprintf(`
-%s: %s - %s
-======
-
-| Month | Snapshot From | Snapshot To | Progress | Epics Planned | Epics Done | Stories Planned | Stories Done |
-| ---   | ---           | ---         | ---      | ---           | ---        | ---             | ---          |`,
-		project, reports[0].From.Format("Jan, 2006"), reports[11].To.Format("Jan, 2006")))
-
-	for _, report := range reports {
-		mdO := fmt.Sprintf(`
-| [%s](#%s) |%s | %s | %.2f | %d -> %d | %d -> %d | **%d** -> %d | %d -> **%d** |`,
-			report.Title,
-			report.To.Format("2006-01"),
-			report.SnapshotFrom.Format(viewDateFormat),
-			report.SnapshotTo.Format(viewDateFormat),
-			report.Progress(),
-			report.LeftEpicsPlanned,
-			report.RightEpicsPlanned,
-			report.LeftEpicsDone,
-			report.RightEpicsDone,
-			report.LeftStoriesPlanned,
-			report.RightStoriesPlanned,
-			report.LeftStoriesDone,
-			report.RightStoriesDone,
-		)
-
-		overview.WriteString(mdO)
-
-		mdD := fmt.Sprintf(`
----
-<a name="%s"></a>%s
-===
-
-Snapshot From: %s  
-Snapshot To: %s  
-		
-| Epic Name | Status | Planning | Due Date | Progress | Stories Total | Stories Done |
-| ---       | ---    | ---      | ---      | ---      | ---		      | ---          |`,
-			report.To.Format("2006-01"),
-			report.Title,
-			report.SnapshotFrom.Format(viewDateFormat),
-			report.SnapshotTo.Format(viewDateFormat),
-		)
-
-		details.WriteString(mdD)
-
-		for _, epicPair := range report.EpicPairs {
-			mdD := fmt.Sprintf(`
-| [%s](%s) %s | %s -> %s | %s | %s -> %s | %.2f | **%d** -> %d | %d -> **%d** |`,
-				epicPair.Key,
-				epicPair.Link,
-				epicPair.Title,
-				epicPair.Left.Status,
-				epicPair.Right.Status,
-				epicPair.PlanningStatus(),
-				epicPair.LeftDueDate(viewDateFormat),
-				epicPair.RightDueDate(viewDateFormat),
-				epicPair.Progress(),
-				len(epicPair.Left.PlanStories),
-				len(epicPair.Right.PlanStories),
-				epicPair.Left.StoriesDone,
-				epicPair.Right.StoriesDone,
-			)
-
-			details.WriteString(mdD)
+	snapshots := make(map[time.Time]bool)
+	for _, window := range windows {
+		from, to, err := calculator.FindSnapshotDatesForPeriod(entries[0].Dates, window.From, window.To)
+		if err != nil {
+			return estimator, err
+		}
+
+		snapshots[from], snapshots[to] = true, true
+
+		next, ok, err := calculator.NextSnapshotDate(entries[0].Dates, window.To)
+		if err != nil {
+			return estimator, err
+		}
+
+		if ok {
+			snapshots[next] = true
 		}
 	}
 
-	details.WriteTo(&overview)
+	dates := make([]time.Time, 0, len(snapshots))
+	for date := range snapshots {
+		dates = append(dates, date)
+	}
 
-	return overview.String()
+	return estimator.ForSnapshots(store, project, dates)
+}
+
+// writeReport writes the report file, the csv epic pairs are written to a separate "-epics" file
+func writeReport(period string, f format.Format, tmpl *template.Template, data format.ReportData, linkPrefix string) error {
+	project := data.Project
+	filename := generateFileName(project, period, f.Ext())
+
+	if f == format.Markdown {
+		return writeFile(filename, func(w io.Writer) error { return format.WriteReportMarkdown(w, tmpl, data) })
+	}
+
+	doc := format.NewReportDoc(project, data.Granularity, data.Reports)
+
+	if f == format.HTML {
+		return writeFile(filename, func(w io.Writer) error { return format.WriteReportHTML(w, doc, data.Histories, linkPrefix) })
+	}
+
+	if err := writeFile(filename, func(w io.Writer) error { return format.WriteReport(w, f, doc) }); err != nil {
+		return err
+	}
+
+	if f != format.CSV {
+		return nil
+	}
+
+	return writeFile(generateFileName(project, period+"-epics", f.Ext()), func(w io.Writer) error {
+		return format.WriteReportEpics(w, doc)
+	})
+}
+
+func writeFile(filename string, write func(io.Writer) error) error {
+	f, err := util.CreateFile(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		return fmt.Errorf("failed to write file: %s. %s", filename, err)
+	}
+
+	return nil
+}
+
+// generateFileName returns a file name for the report period
+func generateFileName(project, period, ext string) string {
+	project = util.RemoveSpaces(project)
+	return fmt.Sprintf("%s/%s/%s-%s%s", InArgs.Dir, project, project, period, ext)
 }
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/makarski/roadsnap/cmd/cache"
+	"github.com/makarski/roadsnap/config"
+)
+
+func verifyCmd(cfg *config.Config) CmdFunc {
+	return func() error {
+		store, err := newStore(cfg)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		verifier, ok := store.(cache.Verifier)
+		if !ok {
+			return fmt.Errorf("storage backend `%s` does not support verification", cfg.Storage.Backend)
+		}
+
+		projects, err := cache.ListSnapshotDates(store, "")
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+
+		for _, project := range projects {
+			fmt.Fprintf(out, "> Verifying project: %s\n", project.Project)
+
+			for _, date := range project.Dates {
+				t, err := time.Parse(dateFormat, date)
+				if err != nil {
+					return fmt.Errorf("failed to parse time for project: %s:%s. %s", project.Project, date, err)
+				}
+
+				result, err := verifier.Verify(project.Project, t)
+				if err != nil {
+					return fmt.Errorf("failed to verify project: %s:%s. %s", project.Project, date, err)
+				}
+
+				switch {
+				case !result.HasManifest:
+					fmt.Fprintf(out, "  * %s: no manifest\n", date)
+				case result.OK():
+					fmt.Fprintf(out, "  * %s: ok\n", date)
+				default:
+					failed++
+					fmt.Fprintf(out, "  * %s: FAILED\n", date)
+					for _, problem := range result.Problems {
+						fmt.Fprintf(out, "    - %s\n", problem)
+					}
+				}
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d snapshot(s) failed verification", failed)
+		}
+
+		return nil
+	}
+}
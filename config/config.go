@@ -3,8 +3,12 @@ package config
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/pelletier/go-toml"
+
+	"github.com/makarski/roadsnap/util"
 )
 
 const DefaultFileName = "rsnap-config.toml"
@@ -15,10 +19,27 @@ type (
 		Projects    *Projects    `toml:"projects"`
 		Epic        *Epic        `toml:"epic"`
 		StatusNames *StatusNames `toml:"status_names"`
+		Fetch       *Fetch       `toml:"fetch"`
+		Storage     *Storage     `toml:"storage"`
+		Retention   *Retention   `toml:"retention"`
+		Estimate    *Estimate    `toml:"estimate"`
+		Report      *Report      `toml:"report"`
+		Templates   *Templates   `toml:"templates"`
 	}
 
 	Projects struct {
-		Names []string `toml:"names"`
+		Names   []string  `toml:"names"`
+		Queries []Project `toml:"queries"`
+	}
+
+	// Project is a named epic selection.
+	// Plain project names are selected by the jira project,
+	// named queries by a user-defined JQL.
+	Project struct {
+		Name      string `toml:"name"`
+		EpicsJQL  string `toml:"epics_jql"`
+		IssuesJQL string `toml:"issues_jql"`
+		ChildLink string `toml:"child_link"`
 	}
 
 	JiraCrd struct {
@@ -30,6 +51,46 @@ type (
 
 	Epic struct {
 		CustomFieldStartDate string `toml:"start_date_field"`
+		From                 string `toml:"from"`
+		To                   string `toml:"to"`
+		Window               string `toml:"window"`
+		IncludeUndated       bool   `toml:"include_undated"`
+		ChildLink            string `toml:"child_link"`
+	}
+
+	Fetch struct {
+		Concurrency       int  `toml:"concurrency"`
+		MaxRetries        int  `toml:"max_retries"`
+		RetryDelaySeconds int  `toml:"retry_delay_seconds"`
+		Changelog         bool `toml:"changelog"`
+	}
+
+	Storage struct {
+		Backend     string `toml:"backend"`
+		Path        string `toml:"path"`
+		Compression string `toml:"compression"`
+		Dedup       bool   `toml:"dedup"`
+	}
+
+	Retention struct {
+		DailyDays     int `toml:"daily_days"`
+		WeeklyWeeks   int `toml:"weekly_weeks"`
+		MonthlyMonths int `toml:"monthly_months"`
+	}
+
+	Estimate struct {
+		Field            string `toml:"field"`
+		StoryPointsField string `toml:"story_points_field"`
+	}
+
+	Report struct {
+		FiscalYearStart int `toml:"fiscal_year_start"`
+	}
+
+	// Templates are the text/template files of the markdown output, the built-in layout if empty
+	Templates struct {
+		List   string `toml:"list"`
+		Report string `toml:"report"`
 	}
 
 	StatusNames struct {
@@ -51,5 +112,100 @@ func LoadConfig(filepath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %s", err)
 	}
 
+	if cfg.Templates == nil {
+		cfg.Templates = &Templates{}
+	}
+
+	if cfg.Report == nil {
+		cfg.Report = &Report{}
+	}
+
+	if cfg.Estimate == nil {
+		cfg.Estimate = &Estimate{}
+	}
+
+	if cfg.Retention == nil {
+		cfg.Retention = &Retention{}
+	}
+
+	if cfg.Storage == nil {
+		cfg.Storage = &Storage{}
+	}
+
+	if cfg.Fetch == nil {
+		cfg.Fetch = &Fetch{}
+	}
+
+	if cfg.Projects == nil {
+		cfg.Projects = &Projects{}
+	}
+
+	if err := cfg.Projects.validate(); err != nil {
+		return nil, fmt.Errorf("invalid projects config: %s", err)
+	}
+
 	return &cfg, nil
 }
+
+// List returns plain project names followed by the named queries
+func (p *Projects) List() []Project {
+	projects := make([]Project, 0, len(p.Names)+len(p.Queries))
+
+	for _, name := range p.Names {
+		projects = append(projects, Project{Name: name})
+	}
+
+	return append(projects, p.Queries...)
+}
+
+// ListNames returns the names of all configured projects and queries
+func (p *Projects) ListNames() []string {
+	projects := p.List()
+	names := make([]string, 0, len(projects))
+
+	for _, project := range projects {
+		names = append(names, project.Name)
+	}
+
+	return names
+}
+
+// orderByRe matches an ORDER BY clause, which is not allowed within the wrapped query JQL
+var orderByRe = regexp.MustCompile(`(?i)\border\s+by\b`)
+
+// validate checks the project names by their cache dir keys, the names without spaces
+func (p *Projects) validate() error {
+	seen := make(map[string]string)
+
+	for _, project := range p.List() {
+		key := util.RemoveSpaces(project.Name)
+		if key == "" {
+			return fmt.Errorf("project name is empty")
+		}
+
+		if strings.Contains(key, "/") || key == "." || key == ".." {
+			return fmt.Errorf("project name is not a valid directory name: %s", project.Name)
+		}
+
+		if other, ok := seen[key]; ok {
+			return fmt.Errorf("duplicate project name: %s, conflicts with: %s", project.Name, other)
+		}
+		seen[key] = project.Name
+	}
+
+	for _, query := range p.Queries {
+		if query.EpicsJQL == "" {
+			return fmt.Errorf("epics_jql is not defined for query: %s", query.Name)
+		}
+
+		if orderByRe.MatchString(query.EpicsJQL) {
+			return fmt.Errorf("epics_jql of query: %s must not contain ORDER BY", query.Name)
+		}
+
+		if orderByRe.MatchString(query.IssuesJQL) {
+			return fmt.Errorf("issues_jql of query: %s must not contain ORDER BY", query.Name)
+		}
+	}
+
+	return nil
+}
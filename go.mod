@@ -4,6 +4,8 @@ go 1.18
 
 require (
 	github.com/andygrunwald/go-jira v1.14.0
+	github.com/klauspost/compress v1.15.15
+	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/pelletier/go-toml v1.9.5
 	github.com/wcharczuk/go-chart/v2 v2.1.0
 )
@@ -31,12 +31,22 @@ func printHelp() {
 Roadsnap - fetches jira project snapshots by epic
 
 USAGE:
-  roadsnap [OPTIONS] [SUBCOMMAND]
+  roadsnap [OPTIONS] [SUBCOMMAND] [SUBCOMMAND OPTIONS]
 
 SUBCOMMANDS:
-  cache - Cache JIRA epics
-  list  - Generate report
-  chart - Generate stacked bar chart for with stats
+  cache - Cache JIRA epics (see: roadsnap cache -help)
+  list  - Generate report (see: roadsnap list -help)
+  chart - Generate stacked bar, burn-up or burn-down charts (see: roadsnap chart -help)
+  report - Generate progress report by week, month, quarter or half-year (see: roadsnap report -help)
+  diff - Compare the epics and stories of two snapshots (see: roadsnap diff -help)
+  history - Show the due date changes of the epics (see: roadsnap history -help)
+  forecast - Forecast the completion of the open epics (see: roadsnap forecast -help)
+  verify - Verify cached snapshots against their manifests
+  prune  - Remove snapshots by the retention policy (see: roadsnap prune -help)
+  export - Pack snapshots into a tar.gz archive (see: roadsnap export -help)
+  import - Merge the snapshots of an exported archive into the cache (see: roadsnap import -help)
+  migrate - Upgrade the cached snapshots to the current layout (see: roadsnap migrate -help)
+  migrate-store - Import the file system snapshots into the configured storage backend
 
 OPTIONS:
 `
@@ -51,7 +61,12 @@ func main() {
 
 	cmdName := fls.Arg(0)
 
-	if err := cmd.Run(cmdName); err != nil {
+	var cmdArgs []string
+	if fls.NArg() > 1 {
+		cmdArgs = fls.Args()[1:]
+	}
+
+	if err := cmd.Run(cmdName, cmdArgs); err != nil {
 		panic(err)
 	}
 }
@@ -0,0 +1,74 @@
+package roadmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+// changelogPageSize is the number of histories requested per changelog page
+const changelogPageSize = 100
+
+// decodeIssue decodes a search result issue.
+// Jira truncates the changelogs expanded in the search results, those are fetched in full.
+func (rv *RoadmapViewer) decodeIssue(raw json.RawMessage) (jira.Issue, error) {
+	var (
+		issue  jira.Issue
+		paging struct {
+			Changelog *struct {
+				Total int `json:"total"`
+			} `json:"changelog"`
+		}
+	)
+
+	if err := json.Unmarshal(raw, &issue); err != nil {
+		return issue, err
+	}
+
+	if err := json.Unmarshal(raw, &paging); err != nil {
+		return issue, err
+	}
+
+	if issue.Changelog == nil || paging.Changelog == nil || paging.Changelog.Total <= len(issue.Changelog.Histories) {
+		return issue, nil
+	}
+
+	histories, err := rv.changelog(issue.Key)
+	if err != nil {
+		return issue, fmt.Errorf("failed to fetch changelog for issue: %s. %s", issue.Key, err)
+	}
+
+	issue.Changelog.Histories = histories
+
+	return issue, nil
+}
+
+// changelog pages through the issue changelog until the reported total is reached
+func (rv *RoadmapViewer) changelog(key string) ([]jira.ChangelogHistory, error) {
+	histories := make([]jira.ChangelogHistory, 0)
+
+	for {
+		var page struct {
+			Total  int                     `json:"total"`
+			IsLast bool                    `json:"isLast"`
+			Values []jira.ChangelogHistory `json:"values"`
+		}
+
+		uv := url.Values{}
+		uv.Add("startAt", strconv.Itoa(len(histories)))
+		uv.Add("maxResults", strconv.Itoa(changelogPageSize))
+
+		if _, err := rv.get(fmt.Sprintf("rest/api/2/issue/%s/changelog?%s", key, uv.Encode()), &page); err != nil {
+			return nil, err
+		}
+
+		histories = append(histories, page.Values...)
+
+		if len(page.Values) == 0 || page.IsLast || len(histories) >= page.Total {
+			return histories, nil
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package roadmap
+
+import (
+	"fmt"
+
+	"github.com/andygrunwald/go-jira"
+
+	"github.com/makarski/roadsnap/config"
+)
+
+// ChildLink defines how epic children are linked to the epic
+type ChildLink string
+
+const (
+	// ChildLinkEpicLink uses the `Epic Link` field of company-managed projects
+	ChildLinkEpicLink ChildLink = "epic_link"
+	// ChildLinkParent uses the `parent` field of team-managed projects
+	ChildLinkParent ChildLink = "parent"
+	// ChildLinkAuto tries `Epic Link` first and falls back to `parent`
+	ChildLinkAuto ChildLink = "auto"
+)
+
+// ParseChildLink returns the child link mode, empty value defaults to auto-detect
+func ParseChildLink(s string) (ChildLink, error) {
+	switch ChildLink(s) {
+	case "", ChildLinkAuto:
+		return ChildLinkAuto, nil
+	case ChildLinkEpicLink, ChildLinkParent:
+		return ChildLink(s), nil
+	}
+
+	return "", fmt.Errorf("unsupported child link: `%s`. expected one of: %s, %s, %s",
+		s, ChildLinkEpicLink, ChildLinkParent, ChildLinkAuto)
+}
+
+func (cl ChildLink) jql(epicKey string) string {
+	if cl == ChildLinkParent {
+		return fmt.Sprintf(`parent=%s`, epicKey)
+	}
+
+	return fmt.Sprintf(`"Epic Link"=%s`, epicKey)
+}
+
+// childLink returns the link mode for a project, the project setting overrides the default one
+func (rv *RoadmapViewer) childLink(project config.Project) (ChildLink, error) {
+	if project.ChildLink != "" {
+		return ParseChildLink(project.ChildLink)
+	}
+
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+
+	if detected, ok := rv.detectedLinks[project.Name]; ok {
+		return detected, nil
+	}
+
+	return rv.defaultChildLink, nil
+}
+
+// detectChildren searches the epic children by `Epic Link` and then by `parent`.
+// The first mode that returns any children is remembered for the project.
+func (rv *RoadmapViewer) detectChildren(project config.Project, key string) ([]jira.Issue, int, error) {
+	issues, total, epicLinkErr := rv.searchChildren(ChildLinkEpicLink, project, key)
+	if epicLinkErr == nil && total > 0 {
+		rv.rememberChildLink(project, ChildLinkEpicLink)
+		return issues, total, nil
+	}
+
+	pIssues, pTotal, parentErr := rv.searchChildren(ChildLinkParent, project, key)
+	if parentErr != nil {
+		if epicLinkErr != nil {
+			return nil, 0, fmt.Errorf("epic link: %s. parent: %s", epicLinkErr, parentErr)
+		}
+
+		// `Epic Link` query succeeded with no children
+		return issues, total, nil
+	}
+
+	if pTotal > 0 {
+		rv.rememberChildLink(project, ChildLinkParent)
+	}
+
+	return pIssues, pTotal, nil
+}
+
+func (rv *RoadmapViewer) rememberChildLink(project config.Project, link ChildLink) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+
+	rv.detectedLinks[project.Name] = link
+}
+
+func (rv *RoadmapViewer) searchChildren(link ChildLink, project config.Project, key string) ([]jira.Issue, int, error) {
+	return rv.searchAll(childrenJQL(link, project, key))
+}
+
+// IssuesJQL returns the JQL template used to select the epic children,
+// `{epic}` stands for the epic key. Auto-detected links are reported once detected.
+func (rv *RoadmapViewer) IssuesJQL(project config.Project) string {
+	link, err := rv.childLink(project)
+	if err != nil {
+		return ""
+	}
+
+	if link == ChildLinkAuto {
+		return fmt.Sprintf("%s: %s | %s", ChildLinkAuto,
+			childrenJQL(ChildLinkEpicLink, project, "{epic}"),
+			childrenJQL(ChildLinkParent, project, "{epic}"))
+	}
+
+	return childrenJQL(link, project, "{epic}")
+}
+
+func childrenJQL(link ChildLink, project config.Project, key string) string {
+	jql := link.jql(key)
+	if project.IssuesJQL != "" {
+		jql += fmt.Sprintf(`&(%s)`, project.IssuesJQL)
+	}
+
+	return jql
+}
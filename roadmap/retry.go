@@ -0,0 +1,90 @@
+package roadmap
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+
+	"github.com/makarski/roadsnap/config"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultRetryDelay = time.Second
+	maxRetryDelay     = time.Minute
+)
+
+// RetryPolicy defines how rate limited jira requests are retried
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+}
+
+// NewRetryPolicy returns the retry policy from the config, falling back to defaults
+func NewRetryPolicy(cfg *config.Fetch) RetryPolicy {
+	policy := RetryPolicy{MaxRetries: defaultMaxRetries, BaseDelay: defaultRetryDelay}
+	if cfg == nil {
+		return policy
+	}
+
+	if cfg.MaxRetries > 0 {
+		policy.MaxRetries = cfg.MaxRetries
+	}
+
+	if cfg.RetryDelaySeconds > 0 {
+		policy.BaseDelay = time.Duration(cfg.RetryDelaySeconds) * time.Second
+	}
+
+	return policy
+}
+
+// get runs a single GET request and retries it while jira responds with
+// 429 Too Many Requests or 503 Service Unavailable.
+// The Retry-After header is respected, otherwise the delay grows exponentially.
+func (rv *RoadmapViewer) get(urlStr string, v interface{}) (*jira.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := rv.jiraClient.NewRequest(http.MethodGet, urlStr, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := rv.jiraClient.Do(req, v)
+		if err == nil {
+			return resp, nil
+		}
+
+		if attempt >= rv.retry.MaxRetries || !retryable(resp) {
+			return resp, jira.NewJiraError(resp, err)
+		}
+
+		time.Sleep(rv.retry.delay(attempt, resp))
+	}
+}
+
+func retryable(resp *jira.Response) bool {
+	if resp == nil || resp.Response == nil {
+		return false
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+func (rp RetryPolicy) delay(attempt int, resp *jira.Response) time.Duration {
+	// Retry-After is capped the same as the backoff
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		if seconds >= int(maxRetryDelay/time.Second) {
+			return maxRetryDelay
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+
+	delay := rp.BaseDelay << attempt
+	if delay <= 0 || delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+
+	return delay
+}
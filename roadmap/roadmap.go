@@ -1,18 +1,37 @@
 package roadmap
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/andygrunwald/go-jira"
 
 	"github.com/makarski/roadsnap/config"
 )
 
+const (
+	// searchPageSize is the number of issues requested per search page
+	searchPageSize = 100
+
+	expandChangelog = "changelog"
+)
+
 type RoadmapViewer struct {
-	jiraClient *jira.Client
+	jiraClient       *jira.Client
+	epicWindow       EpicWindow
+	defaultChildLink ChildLink
+	retry            RetryPolicy
+	expand           string
+
+	mu            sync.Mutex
+	detectedLinks map[string]ChildLink
 }
 
-func NewRoadmapViewer(cfg *config.JiraCrd) (*RoadmapViewer, error) {
+func NewRoadmapViewer(cfg *config.JiraCrd, epicWindow EpicWindow, childLink ChildLink, retry RetryPolicy) (*RoadmapViewer, error) {
 	tp := jira.BasicAuthTransport{
 		Username: cfg.User,
 		Password: cfg.Token,
@@ -23,28 +42,165 @@ func NewRoadmapViewer(cfg *config.JiraCrd) (*RoadmapViewer, error) {
 		return nil, fmt.Errorf("failed to init jira client: %s", err)
 	}
 
-	return &RoadmapViewer{jiraClient}, nil
+	return &RoadmapViewer{
+		jiraClient:       jiraClient,
+		epicWindow:       epicWindow,
+		defaultChildLink: childLink,
+		retry:            retry,
+		detectedLinks:    make(map[string]ChildLink),
+	}, nil
+}
+
+// SetChangelog defines whether the issue changelogs are fetched along with the issues
+func (rv *RoadmapViewer) SetChangelog(enabled bool) {
+	rv.expand = ""
+	if enabled {
+		rv.expand = expandChangelog
+	}
 }
 
-func (rv *RoadmapViewer) ListEpics(project string) ([]jira.Issue, error) {
-	// todo: add an option to set dates
-	jql := fmt.Sprintf(`project="%s"&issuetype="Epic"&"Start date[Date]">startOfYear()`, project)
+// Changelog returns true if the issue changelogs are fetched
+func (rv *RoadmapViewer) Changelog() bool {
+	return rv.expand == expandChangelog
+}
+
+// ListEpics returns all project epics along with the total reported by jira.
+// Named queries select epics by their own JQL, the epic window is applied on top.
+func (rv *RoadmapViewer) ListEpics(project config.Project) ([]jira.Issue, int, error) {
+	epics, total, err := rv.searchAll(rv.EpicsJQL(project))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch epics for project: %s. %s", project.Name, err)
+	}
+
+	return epics, total, nil
+}
+
+// EpicsJQL returns the JQL used to select the project epics
+func (rv *RoadmapViewer) EpicsJQL(project config.Project) string {
+	jql := fmt.Sprintf(`project="%s"&issuetype="Epic"`, project.Name)
+	if project.EpicsJQL != "" {
+		jql = fmt.Sprintf(`(%s)`, project.EpicsJQL)
+	}
+
+	if cond := rv.epicWindow.jql(); cond != "" {
+		jql += "&" + cond
+	}
+
+	return jql
+}
+
+// ListEpicIssues returns all epic issues along with the total reported by jira.
+// Children are linked either by `Epic Link` (company-managed projects)
+// or by `parent` (team-managed projects), see ChildLink.
+// The project issues JQL, if defined, narrows down the epic children.
+func (rv *RoadmapViewer) ListEpicIssues(project config.Project, key string) ([]jira.Issue, int, error) {
+	link, err := rv.childLink(project)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		issues []jira.Issue
+		total  int
+	)
+
+	if link == ChildLinkAuto {
+		issues, total, err = rv.detectChildren(project, key)
+	} else {
+		issues, total, err = rv.searchChildren(link, project, key)
+	}
 
-	epics, _, err := rv.jiraClient.Issue.Search(jql, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch epics for project: %s. %s", project, err)
+		return nil, 0, fmt.Errorf("failed to fetch issues for epic: %s. %s", key, err)
 	}
 
-	return epics, nil
+	return issues, total, nil
 }
 
-func (rv *RoadmapViewer) ListEpicIssues(key string) ([]jira.Issue, error) {
-	jql := fmt.Sprintf(`"Epic Link"=%s`, key)
+// search runs a single search request, see decodeIssue
+func (rv *RoadmapViewer) search(jql string, opts *jira.SearchOptions) ([]jira.Issue, *jira.Response, error) {
+	uv := url.Values{}
+	uv.Add("jql", jql)
 
-	issues, _, err := rv.jiraClient.Issue.Search(jql, nil)
+	if opts.StartAt != 0 {
+		uv.Add("startAt", strconv.Itoa(opts.StartAt))
+	}
+
+	if opts.MaxResults != 0 {
+		uv.Add("maxResults", strconv.Itoa(opts.MaxResults))
+	}
+
+	if opts.Expand != "" {
+		uv.Add("expand", opts.Expand)
+	}
+
+	var result struct {
+		Issues []json.RawMessage `json:"issues"`
+		Total  int               `json:"total"`
+	}
+
+	resp, err := rv.get("rest/api/2/search?"+uv.Encode(), &result)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch issues for epic: %s. %s", key, err)
+		return nil, resp, err
+	}
+
+	resp.Total = result.Total
+
+	issues := make([]jira.Issue, 0, len(result.Issues))
+	for _, raw := range result.Issues {
+		issue, err := rv.decodeIssue(raw)
+		if err != nil {
+			return nil, resp, err
+		}
+
+		issues = append(issues, issue)
 	}
 
-	return issues, nil
+	return issues, resp, nil
+}
+
+// searchAll pages through the search results until the reported total is reached
+// or jira returns an empty page. The results changed by the issues created or deleted
+// while paging, reported as a different total by a later page, are fetched again.
+func (rv *RoadmapViewer) searchAll(jql string) ([]jira.Issue, int, error) {
+	for attempt := 0; ; attempt++ {
+		issues, total, resp, err := rv.searchPages(jql)
+		if err != nil || resp == nil {
+			return issues, total, err
+		}
+
+		if attempt >= rv.retry.MaxRetries {
+			return nil, 0, fmt.Errorf("search results changed while paging, %d retries exhausted", attempt)
+		}
+
+		time.Sleep(rv.retry.delay(attempt, resp))
+	}
+}
+
+// searchPages returns the search results of a single pass,
+// the response of the page which reported a different total if the results changed
+func (rv *RoadmapViewer) searchPages(jql string) ([]jira.Issue, int, *jira.Response, error) {
+	issues := make([]jira.Issue, 0)
+	opts := &jira.SearchOptions{StartAt: 0, MaxResults: searchPageSize, Expand: rv.expand}
+	total := -1
+
+	for {
+		page, resp, err := rv.search(jql, opts)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+
+		if total >= 0 && resp.Total != total {
+			return nil, 0, resp, nil
+		}
+		total = resp.Total
+
+		issues = append(issues, page...)
+
+		if len(page) == 0 || len(issues) >= total {
+			return issues, total, nil, nil
+		}
+
+		opts.StartAt += len(page)
+	}
 }
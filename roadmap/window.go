@@ -0,0 +1,122 @@
+package roadmap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/makarski/roadsnap/config"
+)
+
+const (
+	windowDateFormat = "2006-01-02"
+	startDateJQL     = `"Start date[Date]"`
+)
+
+// EpicWindow is the start date range used to select epics
+type EpicWindow struct {
+	From           time.Time
+	To             time.Time
+	IncludeUndated bool
+}
+
+// NewEpicWindow builds the epic selection window from the config.
+// An explicit from date and a relative window are mutually exclusive.
+// If neither is set the window starts at the beginning of the current year.
+func NewEpicWindow(cfg *config.Epic, now time.Time) (EpicWindow, error) {
+	window := EpicWindow{IncludeUndated: cfg.IncludeUndated}
+
+	if cfg.From != "" && cfg.Window != "" {
+		return window, fmt.Errorf("epic window: `from` and `window` are mutually exclusive")
+	}
+
+	if cfg.From != "" {
+		from, err := time.Parse(windowDateFormat, cfg.From)
+		if err != nil {
+			return window, fmt.Errorf("epic window: failed to parse from date: %s", err)
+		}
+		window.From = from
+	}
+
+	if cfg.To != "" {
+		to, err := time.Parse(windowDateFormat, cfg.To)
+		if err != nil {
+			return window, fmt.Errorf("epic window: failed to parse to date: %s", err)
+		}
+		window.To = to
+	}
+
+	if cfg.Window != "" {
+		from, err := relativeWindowStart(cfg.Window, now)
+		if err != nil {
+			return window, fmt.Errorf("epic window: %s", err)
+		}
+		window.From = from
+	}
+
+	if window.From.IsZero() && window.To.IsZero() {
+		window.From = time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	if !window.To.IsZero() && window.To.Before(window.From) {
+		return window, fmt.Errorf("epic window: to date %s is before from date %s",
+			window.To.Format(windowDateFormat), window.From.Format(windowDateFormat))
+	}
+
+	return window, nil
+}
+
+// jql returns the start date condition for the epic search
+func (w EpicWindow) jql() string {
+	conds := make([]string, 0, 2)
+
+	if !w.From.IsZero() {
+		conds = append(conds, fmt.Sprintf(`%s>="%s"`, startDateJQL, w.From.Format(windowDateFormat)))
+	}
+
+	if !w.To.IsZero() {
+		conds = append(conds, fmt.Sprintf(`%s<="%s"`, startDateJQL, w.To.Format(windowDateFormat)))
+	}
+
+	cond := strings.Join(conds, "&")
+
+	if w.IncludeUndated && cond != "" {
+		return fmt.Sprintf(`((%s) OR %s is EMPTY)`, cond, startDateJQL)
+	}
+
+	return cond
+}
+
+// relativeWindowStart parses windows such as "last 18 months", "2 years" or "90 days"
+// and returns the window start relative to now
+func relativeWindowStart(window string, now time.Time) (time.Time, error) {
+	parts := strings.Fields(strings.ToLower(window))
+	if len(parts) > 0 && parts[0] == "last" {
+		parts = parts[1:]
+	}
+
+	if len(parts) != 2 {
+		return time.Time{}, fmt.Errorf("failed to parse relative window: `%s`", window)
+	}
+
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n <= 0 {
+		return time.Time{}, fmt.Errorf("failed to parse relative window amount: `%s`", window)
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch strings.TrimSuffix(parts[1], "s") {
+	case "day":
+		return today.AddDate(0, 0, -n), nil
+	case "week":
+		return today.AddDate(0, 0, -7*n), nil
+	case "month":
+		return today.AddDate(0, -n, 0), nil
+	case "year":
+		return today.AddDate(-n, 0, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported relative window unit: `%s`", window)
+}
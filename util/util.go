@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"strings"
@@ -20,6 +21,37 @@ func CreateFile(fileKey string) (*os.File, error) {
 	return f, nil
 }
 
+// WriteFileAtomic writes to a temporary file next to the target
+// and renames it into place once the write succeeded
+func WriteFileAtomic(fileKey string, write func(io.Writer) error) error {
+	if err := createDir(fileKey); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(path.Dir(fileKey), path.Base(fileKey)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create a temp file for key: %s. %s", fileKey, err)
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write file for key: %s. %s", fileKey, err)
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to close file for key: %s. %s", fileKey, err)
+	}
+
+	if err := os.Rename(f.Name(), fileKey); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to rename file for key: %s. %s", fileKey, err)
+	}
+
+	return nil
+}
+
 func createDir(key string) error {
 	if err := os.MkdirAll(path.Dir(key), os.FileMode(0744)); err != nil {
 		return fmt.Errorf("failed to create dir for key: %s. %s", key, err)